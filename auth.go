@@ -0,0 +1,183 @@
+package remilia
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// LoginFunc authenticates a session before the crawl starts and again whenever
+// the session expires. It sends its requests with login.Do, so the cookies it
+// receives are kept in the jar of the session.
+type LoginFunc func(ctx context.Context, login *Login) error
+
+// SessionExpiredFunc reports whether resp shows that the session it was sent with expired.
+type SessionExpiredFunc func(resp *Response) bool
+
+// SessionExpiredOnStatus reports a session as expired when the response has one of codes.
+func SessionExpiredOnStatus(codes ...int) SessionExpiredFunc {
+	return func(resp *Response) bool {
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Login sends the requests of a LoginFunc through the client of the crawl.
+type Login struct {
+	session string
+	client  httpClient
+	headers map[string]string
+}
+
+// Session returns the session being authenticated.
+func (l *Login) Session() string {
+	return l.session
+}
+
+// SetHeader adds a header, e.g. an exchanged token, to every later request of the session.
+func (l *Login) SetHeader(key, value string) {
+	l.headers[key] = value
+}
+
+// Do sends req with the cookies and headers of the session being authenticated.
+func (l *Login) Do(ctx context.Context, req *Request) (*Response, error) {
+	req.Session = l.session
+	for key, value := range l.headers {
+		req.Headers.Set(key, value)
+	}
+	return l.client.execute(ctx, req)
+}
+
+// authSession is the authentication state of one session.
+type authSession struct {
+	mu      sync.RWMutex
+	gen     uint64
+	headers map[string]string
+}
+
+// authenticator logs sessions in and detects their expiry.
+type authenticator struct {
+	login   LoginFunc
+	expired SessionExpiredFunc
+
+	mu       sync.Mutex
+	sessions map[string]*authSession
+}
+
+func newAuthenticator(login LoginFunc, expired SessionExpiredFunc) *authenticator {
+	return &authenticator{
+		login:    login,
+		expired:  expired,
+		sessions: make(map[string]*authSession),
+	}
+}
+
+func (a *authenticator) sessionFor(session string) *authSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.sessions[session]
+	if !ok {
+		s = &authSession{headers: make(map[string]string)}
+		a.sessions[session] = s
+	}
+	return s
+}
+
+// apply adds the headers of the session of req to it and returns the login
+// generation req is sent with.
+func (a *authenticator) apply(req *Request) uint64 {
+	s := a.sessionFor(req.Session)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key, value := range s.headers {
+		req.Headers.Set(key, value)
+	}
+	return s.gen
+}
+
+func (a *authenticator) generation(session string) uint64 {
+	s := a.sessionFor(session)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.gen
+}
+
+// authenticate logs session in, unless it was already logged in again since
+// generation gen. Concurrent callers which saw the same expiry share one login.
+func (a *authenticator) authenticate(ctx context.Context, client httpClient, session string, gen uint64) error {
+	s := a.sessionFor(session)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gen != gen {
+		return nil
+	}
+
+	login := &Login{
+		session: session,
+		client:  client,
+		headers: make(map[string]string, len(s.headers)),
+	}
+	for key, value := range s.headers {
+		login.headers[key] = value
+	}
+
+	if err := a.login(ctx, login); err != nil {
+		return fmt.Errorf("%w: %w", errLoginFailed, err)
+	}
+
+	s.headers = login.headers
+	s.gen++
+	return nil
+}
+
+func (a *authenticator) isExpired(resp *Response) bool {
+	return a.expired != nil && a.expired(resp)
+}
+
+// fetch executes req, and when the response shows an expired session, logs
+// the session in again and replays req once.
+func (r *Remilia) fetch(ctx context.Context, req *Request) (*Response, error) {
+	if r.auth == nil {
+		return r.client.execute(ctx, req)
+	}
+
+	gen := r.auth.apply(req)
+	resp, err := r.client.execute(ctx, req)
+	if err != nil || !r.auth.isExpired(resp) {
+		return resp, err
+	}
+
+	r.logger.Info("Session expired", logContext{
+		"url":     string(req.URL),
+		"session": req.Session,
+	})
+
+	if err := r.auth.authenticate(ctx, r.client, req.Session, gen); err != nil {
+		r.logger.Error("Failed to log in", logContext{
+			"session": req.Session,
+			"err":     err,
+		})
+		return nil, err
+	}
+
+	r.auth.apply(req)
+	resp, err = r.client.execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if r.auth.isExpired(resp) {
+		return nil, errSessionExpired
+	}
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+package remilia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenHTTPClient accepts requests carrying the current token and expires the
+// token after every expireAfter accepted requests.
+type tokenHTTPClient struct {
+	mu          sync.Mutex
+	token       string
+	accepted    int
+	expireAfter int
+	urls        []string
+}
+
+func (c *tokenHTTPClient) execute(ctx context.Context, request *Request) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.urls = append(c.urls, string(request.URL))
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(`<a href="/a"></a>`))
+	resp := &Response{Request: request, URL: string(request.URL), StatusCode: http.StatusOK, document: doc}
+
+	if strings.HasSuffix(string(request.URL), "/login") {
+		c.token = fmt.Sprintf("token-%d", len(c.urls))
+		resp.Body = []byte(c.token)
+		return resp, nil
+	}
+
+	if c.token == "" || string(request.Headers.Peek("Authorization")) != "Bearer "+c.token {
+		resp.StatusCode = http.StatusUnauthorized
+		return resp, nil
+	}
+
+	c.accepted++
+	if c.expireAfter > 0 && c.accepted%c.expireAfter == 0 {
+		c.token = ""
+	}
+	return resp, nil
+}
+
+func tokenLogin(logins *int) LoginFunc {
+	return func(ctx context.Context, login *Login) error {
+		*logins++
+		req, _ := NewRequest("POST", "http://example.com/login")
+		resp, err := login.Do(ctx, req)
+		if err != nil {
+			return err
+		}
+		login.SetHeader("Authorization", "Bearer "+string(resp.Body))
+		return nil
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("Log in before the crawl and again on expiry", func(t *testing.T) {
+		logins := 0
+		client := &tokenHTTPClient{expireAfter: 1}
+		instance, _ := New(WithLogin(tokenLogin(&logins), SessionExpiredOnStatus(http.StatusUnauthorized)))
+		instance.client = client
+
+		var statuses []int
+		layer := func(resp *Response, put Put[*Request], emit Put[Item]) {
+			statuses = append(statuses, resp.StatusCode)
+		}
+
+		first, _ := NewRequest("GET", "http://example.com/first")
+		second, _ := NewRequest("GET", "http://example.com/second")
+		err := instance.Do(instance.RequestProvider(first, second), newActionLayer[*Request](instance.wrapLayerFunc(layer)))
+
+		assert.NoError(t, err, "Do should not return an error")
+		assert.Equal(t, 2, logins, "The session should log in before the crawl and again on expiry")
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK}, statuses, "The failed request should be replayed")
+		assert.Equal(t, []string{
+			"http://example.com/login",
+			"http://example.com/first",
+			"http://example.com/second",
+			"http://example.com/login",
+			"http://example.com/second",
+		}, client.urls, "The request should be replayed after the login")
+	})
+
+	t.Run("Failed login stops the crawl", func(t *testing.T) {
+		instance, _ := New(WithLogin(func(ctx context.Context, login *Login) error {
+			return errors.New("bad credentials")
+		}, nil))
+		instance.client = &tokenHTTPClient{}
+
+		noop := func(in *goquery.Document, put Put[string]) {}
+		err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddLayer(noop))
+
+		assert.ErrorIs(t, err, errLoginFailed, "Do should return the login error")
+	})
+
+	t.Run("Concurrent expiries share one login", func(t *testing.T) {
+		logins := 0
+		auth := newAuthenticator(tokenLogin(&logins), nil)
+		client := &tokenHTTPClient{}
+
+		gen := auth.generation("")
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, auth.authenticate(context.Background(), client, "", gen))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, logins, "Callers which saw the same expiry should share one login")
+	})
+}
@@ -31,11 +31,42 @@ type exponentialBackoff struct {
 	attempt       uint8
 	maxAttempt    uint8
 	linearAttempt uint8
+	jitter        JitterStrategy
 
 	random  randomWrapper
 	backoff jitterBackoff
 }
 
+// JitterStrategy selects how the delay between attempts is computed.
+type JitterStrategy int
+
+const (
+	// FullJitter waits a random delay between the min delay and the growing ceiling.
+	FullJitter JitterStrategy = iota
+	// EqualJitter waits half of the ceiling plus a random delay up to the other half.
+	EqualJitter
+	// DecorrelatedJitter waits a random delay between the min delay and
+	// multiplier times the previous delay.
+	DecorrelatedJitter
+	// NoJitter waits the ceiling itself.
+	NoJitter
+	// ConstantBackoff always waits the min delay.
+	ConstantBackoff
+	// FibonacciBackoff waits the min delay times the Fibonacci number of the attempt.
+	FibonacciBackoff
+)
+
+type jitterBuilder func(minDelay time.Duration, capacity time.Duration, multiplier float64, linearAttempt uint8, random randomWrapper) jitterBackoff
+
+var jitterBuilders = map[JitterStrategy]jitterBuilder{
+	FullJitter:         fullJitterBuilder,
+	EqualJitter:        equalJitterBuilder,
+	DecorrelatedJitter: decorrelatedJitterBuilder,
+	NoJitter:           noJitterBuilder,
+	ConstantBackoff:    constantBuilder,
+	FibonacciBackoff:   fibonacciBuilder,
+}
+
 var (
 	defaultMinDelay      = 1000 * time.Millisecond
 	defaultMaxDelay      = 50 * time.Second
@@ -61,7 +92,11 @@ func newExponentialBackoff(optFns ...exponentialBackoffOptionFunc) *exponentialB
 		optFn(eb)
 	}
 
-	eb.backoff = fullJitterBuilder(eb.minDelay, eb.maxDelay, eb.multiplier, eb.random)
+	build, ok := jitterBuilders[eb.jitter]
+	if !ok {
+		build = fullJitterBuilder
+	}
+	eb.backoff = build(eb.minDelay, eb.maxDelay, eb.multiplier, eb.linearAttempt, eb.random)
 	eb.Reset()
 
 	return eb
@@ -130,16 +165,40 @@ func WithWorkLinearAttempt(a uint8) exponentialBackoffOptionFunc {
 	}
 }
 
+func WithWorkJitter(strategy JitterStrategy) exponentialBackoffOptionFunc {
+	return func(eb *exponentialBackoff) error {
+		eb.jitter = strategy
+		return nil
+	}
+}
+
 type jitterBackoff func(attempt uint8) time.Duration
 
-func fullJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplier float64, random randomWrapper) jitterBackoff {
+// growthCeiling returns the upper bound of the delay of attempt. The bound grows
+// as minDelay * attempt^multiplier up to linearAttempt, then linearly by the last increment.
+func growthCeiling(minDelay time.Duration, multiplier float64, linearAttempt uint8, attempt uint8) float64 {
+	base := float64(minDelay)
+	exponential := func(n uint8) float64 {
+		return base * math.Pow(float64(n), multiplier)
+	}
+
+	if attempt <= linearAttempt {
+		return exponential(attempt)
+	}
+
+	last := exponential(linearAttempt)
+	step := last - exponential(linearAttempt-1)
+	if linearAttempt == 0 || step <= 0 {
+		step = base
+	}
+	return last + float64(attempt-linearAttempt)*step
+}
+
+func fullJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplier float64, linearAttempt uint8, random randomWrapper) jitterBackoff {
 	return func(attempt uint8) time.Duration {
-		cap := float64(capacity)
-		att := float64(attempt)
 		base := float64(minDelay)
 
-		// TODO: switch to linear backoff after a certain number of attempts
-		temp := math.Min(cap, base*math.Pow(att, multiplier))
+		temp := math.Min(float64(capacity), growthCeiling(minDelay, multiplier, linearAttempt, attempt))
 		diff := int64(temp) - int64(base)
 		if diff <= 0 {
 			diff = 1
@@ -150,50 +209,123 @@ func fullJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplie
 	}
 }
 
-// type exponentialBackoffFactory struct {
-// 	opts []exponentialBackoffOptionFunc
-// }
+func equalJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplier float64, linearAttempt uint8, random randomWrapper) jitterBackoff {
+	return func(attempt uint8) time.Duration {
+		temp := int64(math.Min(float64(capacity), growthCeiling(minDelay, multiplier, linearAttempt, attempt)))
+		half := temp / 2
+		if half <= 0 {
+			return time.Duration(temp)
+		}
 
-// func newExponentialBackoffFactory(opts ...exponentialBackoffOptionFunc) *exponentialBackoffFactory {
-// 	return &exponentialBackoffFactory{
-// 		opts: opts,
-// 	}
-// }
+		return time.Duration(half + random.Int63n(temp-half))
+	}
+}
 
-// func (f *exponentialBackoffFactory) New() *exponentialBackoff {
-// 	return newExponentialBackoff(f.opts...)
-// }
+// decorrelatedJitterBuilder keeps the previous delay, which is forgotten
+// when the attempts start over after a reset.
+func decorrelatedJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplier float64, _ uint8, random randomWrapper) jitterBackoff {
+	prev := minDelay
+	return func(attempt uint8) time.Duration {
+		if attempt <= 1 {
+			prev = minDelay
+		}
 
-// func (f *exponentialBackoffFactory) Reset(eb *exponentialBackoff) {
-// 	eb.Reset()
-// }
+		upper := math.Min(float64(capacity), float64(prev)*multiplier)
+		diff := int64(upper) - int64(minDelay)
+		if diff <= 0 {
+			diff = 1
+		}
+		prev = time.Duration(random.Int63n(diff) + int64(minDelay))
+
+		return prev
+	}
+}
+
+func noJitterBuilder(minDelay time.Duration, capacity time.Duration, multiplier float64, linearAttempt uint8, _ randomWrapper) jitterBackoff {
+	return func(attempt uint8) time.Duration {
+		return time.Duration(math.Min(float64(capacity), growthCeiling(minDelay, multiplier, linearAttempt, attempt)))
+	}
+}
+
+func constantBuilder(minDelay time.Duration, _ time.Duration, _ float64, _ uint8, _ randomWrapper) jitterBackoff {
+	return func(uint8) time.Duration {
+		return minDelay
+	}
+}
+
+func fibonacciBuilder(minDelay time.Duration, capacity time.Duration, _ float64, _ uint8, _ randomWrapper) jitterBackoff {
+	return func(attempt uint8) time.Duration {
+		prev, delay := time.Duration(0), minDelay
+		for i := uint8(1); i < attempt; i++ {
+			prev, delay = delay, prev+delay
+			if delay >= capacity {
+				return capacity
+			}
+		}
+
+		if delay > capacity {
+			return capacity
+		}
+		return delay
+	}
+}
+
+// exponentialBackoffFactory builds the pooled backoffs from the options of the client.
+type exponentialBackoffFactory struct {
+	opts []exponentialBackoffOptionFunc
+}
+
+func newExponentialBackoffFactory(opts ...exponentialBackoffOptionFunc) *exponentialBackoffFactory {
+	return &exponentialBackoffFactory{
+		opts: opts,
+	}
+}
+
+func (f *exponentialBackoffFactory) New() *exponentialBackoff {
+	return newExponentialBackoff(f.opts...)
+}
+
+func (f *exponentialBackoffFactory) Reset(eb *exponentialBackoff) {
+	eb.Reset()
+}
 
 func retry(ctx context.Context, op ExecutableFunc, eb backoff) error {
-	var lastErr error
-	maxAttempts := eb.GetMaxAttempt()
+	return retryWithDecider(ctx, op, eb, eb.GetMaxAttempt(), func(uint8, error) (bool, time.Duration) {
+		return true, 0
+	})
+}
 
+// retryWithDecider runs op up to maxAttempts times, as long as decide retries its errors.
+func retryWithDecider(ctx context.Context, op ExecutableFunc, eb backoff, maxAttempts uint8, decide retryDecider) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			lastErr = op()
-			if lastErr == nil {
-				return nil
-			}
+		}
 
-			delay := eb.Next()
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(delay):
-			}
+		err := op()
+		if err == nil {
+			return nil
 		}
 
+		// The decider is only asked once a retry is possible, since it may spend a budget
+		delay := eb.Next()
 		if eb.GetCurrentAttempt() >= maxAttempts {
-			break
+			return err
+		}
+		ok, override := decide(eb.GetCurrentAttempt(), err)
+		if !ok {
+			return err
+		}
+		if override > 0 {
+			delay = override
 		}
-	}
 
-	return lastErr
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
 }
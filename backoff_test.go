@@ -101,7 +101,7 @@ func TestFullJitterBuilder(t *testing.T) {
 		returnValues: []int64{1, 2, 3},
 	}
 
-	backoffFunc := fullJitterBuilder(minDelay, capacity, multiplier, random)
+	backoffFunc := fullJitterBuilder(minDelay, capacity, multiplier, defaultLinearAttempt, random)
 
 	testCases := []struct {
 		attempt  uint8
@@ -119,6 +119,51 @@ func TestFullJitterBuilder(t *testing.T) {
 	}
 }
 
+func TestGrowthCeiling(t *testing.T) {
+	testCases := []struct {
+		name          string
+		linearAttempt uint8
+		attempts      []uint8
+		expected      []time.Duration
+	}{
+		{"Exponential then linear", 3, []uint8{1, 2, 3, 4, 5}, []time.Duration{1 * time.Second, 4 * time.Second, 9 * time.Second, 14 * time.Second, 19 * time.Second}},
+		{"Linear from the first attempt", 0, []uint8{1, 2, 3}, []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second}},
+		{"Linear after the first attempt", 1, []uint8{1, 2, 3}, []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, attempt := range tc.attempts {
+				ceiling := growthCeiling(time.Second, 2.0, tc.linearAttempt, attempt)
+				assert.Equal(t, float64(tc.expected[i]), ceiling, "ceiling of attempt %d should be %s", attempt, tc.expected[i])
+			}
+		})
+	}
+}
+
+// maxRandom returns the upper bound of the jitter.
+type maxRandom struct{}
+
+func (maxRandom) Int63n(n int64) int64 {
+	return n - 1
+}
+
+func TestFullJitterBuilderBounds(t *testing.T) {
+	backoffFunc := fullJitterBuilder(time.Second, 20*time.Second, 2.0, 2, maxRandom{})
+
+	assert.Equal(t, 4*time.Second-1, backoffFunc(2), "backoff should be below the exponential ceiling")
+	assert.Equal(t, 10*time.Second-1, backoffFunc(4), "backoff should be below the linear ceiling")
+	assert.Equal(t, 20*time.Second-1, backoffFunc(10), "backoff should be below the max delay")
+}
+
+func TestExponentialBackoffFactory(t *testing.T) {
+	factory := newExponentialBackoffFactory(WithWorkMaxAttempt(3), WithWorkMinDelay(time.Millisecond))
+	eb := factory.New()
+
+	assert.Equal(t, uint8(3), eb.GetMaxAttempt(), "pooled backoff should use the configured max attempt")
+	assert.Equal(t, time.Millisecond, eb.minDelay, "pooled backoff should use the configured min delay")
+}
+
 type mockExponentialBackoff struct {
 	Attempt    uint8
 	MaxAttempt uint8
@@ -245,3 +290,51 @@ func TestRetry(t *testing.T) {
 		assert.Equal(t, context.Canceled, err, "err should be equal to context.Canceled")
 	})
 }
+
+func TestJitterStrategies(t *testing.T) {
+	delays := func(strategy JitterStrategy, random randomWrapper, attempts uint8) []time.Duration {
+		eb := newExponentialBackoff(
+			WithWorkJitter(strategy),
+			WithWorkMinDelay(time.Second),
+			WithWorkMaxDelay(10*time.Second),
+			WithWorkLinearAttempt(2),
+			withRandomImp(random),
+		)
+
+		var result []time.Duration
+		for i := uint8(0); i < attempts; i++ {
+			result = append(result, eb.Next())
+		}
+		return result
+	}
+
+	testCases := []struct {
+		name     string
+		strategy JitterStrategy
+		random   randomWrapper
+		expected []time.Duration
+	}{
+		{"Equal jitter at the lower bound", EqualJitter, &mockRandom{}, []time.Duration{500 * time.Millisecond, 2 * time.Second, 3500 * time.Millisecond, 5 * time.Second, 5 * time.Second, 5 * time.Second}},
+		{"Equal jitter at the upper bound", EqualJitter, maxRandom{}, []time.Duration{time.Second - 1, 4*time.Second - 1, 7*time.Second - 1, 10*time.Second - 1, 10*time.Second - 1, 10*time.Second - 1}},
+		{"Decorrelated jitter at the upper bound", DecorrelatedJitter, maxRandom{}, []time.Duration{2*time.Second - 1, 4*time.Second - 3, 8*time.Second - 7, 10*time.Second - 1, 10*time.Second - 1}},
+		{"Decorrelated jitter at the lower bound", DecorrelatedJitter, &mockRandom{}, []time.Duration{time.Second, time.Second, time.Second}},
+		{"No jitter", NoJitter, &mockRandom{}, []time.Duration{1 * time.Second, 4 * time.Second, 7 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second}},
+		{"Constant", ConstantBackoff, maxRandom{}, []time.Duration{time.Second, time.Second, time.Second}},
+		{"Fibonacci", FibonacciBackoff, maxRandom{}, []time.Duration{1 * time.Second, 1 * time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second, 8 * time.Second, 10 * time.Second}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, delays(tc.strategy, tc.random, uint8(len(tc.expected))), "delays should match the strategy")
+		})
+	}
+
+	t.Run("Decorrelated jitter starts over after a reset", func(t *testing.T) {
+		eb := newExponentialBackoff(WithWorkJitter(DecorrelatedJitter), WithWorkMinDelay(time.Second), withRandomImp(maxRandom{}))
+		first := eb.Next()
+		eb.Next()
+		eb.Reset()
+
+		assert.Equal(t, first, eb.Next(), "the first delay should not depend on the previous attempts")
+	})
+}
@@ -0,0 +1,309 @@
+package remilia
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errCircuitOpen         = errors.New("circuit breaker is open")
+	errInvalidFailureRatio = errors.New("invalid failure ratio")
+	errInvalidMinRequests  = errors.New("invalid min requests")
+	errInvalidBreakerTime  = errors.New("invalid breaker duration")
+	errInvalidRetryRatio   = errors.New("invalid retry ratio")
+)
+
+var (
+	defaultFailureRatio     = 0.5
+	defaultMinRequests      = 10
+	defaultBreakerWindow    = time.Minute
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerSettings describes when the breaker of a host trips and recovers.
+type breakerSettings struct {
+	// FailureRatio of the attempts in a window which trips the breaker.
+	FailureRatio float64
+	// MinRequests is the number of attempts in a window before the ratio is considered.
+	MinRequests int
+	// Window is how long the attempts are counted before the counts start over.
+	Window time.Duration
+	// OpenTimeout is how long the breaker fails fast before probing the host again.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes let through at once while half-open.
+	HalfOpenRequests int
+}
+
+func newBreakerSettings() *breakerSettings {
+	return &breakerSettings{
+		FailureRatio:     defaultFailureRatio,
+		MinRequests:      defaultMinRequests,
+		Window:           defaultBreakerWindow,
+		OpenTimeout:      defaultOpenTimeout,
+		HalfOpenRequests: defaultHalfOpenRequests,
+	}
+}
+
+type BreakerOptionFunc optionFunc[*breakerSettings]
+
+// WithBreakerFailureRatio sets the ratio of failed attempts which trips the breaker of a host.
+func WithBreakerFailureRatio(ratio float64) BreakerOptionFunc {
+	return func(s *breakerSettings) error {
+		if ratio <= 0 || ratio > 1 {
+			return errInvalidFailureRatio
+		}
+		s.FailureRatio = ratio
+		return nil
+	}
+}
+
+// WithBreakerMinRequests sets how many attempts a window needs before the breaker may trip.
+func WithBreakerMinRequests(n int) BreakerOptionFunc {
+	return func(s *breakerSettings) error {
+		if n <= 0 {
+			return errInvalidMinRequests
+		}
+		s.MinRequests = n
+		return nil
+	}
+}
+
+// WithBreakerWindow sets how long attempts are counted before the counts start over.
+func WithBreakerWindow(window time.Duration) BreakerOptionFunc {
+	return func(s *breakerSettings) error {
+		if window <= 0 {
+			return errInvalidBreakerTime
+		}
+		s.Window = window
+		return nil
+	}
+}
+
+// WithBreakerOpenTimeout sets how long an open breaker fails fast before probing the host.
+func WithBreakerOpenTimeout(timeout time.Duration) BreakerOptionFunc {
+	return func(s *breakerSettings) error {
+		if timeout <= 0 {
+			return errInvalidBreakerTime
+		}
+		s.OpenTimeout = timeout
+		return nil
+	}
+}
+
+// WithBreakerHalfOpenRequests sets how many probes a half-open breaker lets through at once.
+func WithBreakerHalfOpenRequests(n int) BreakerOptionFunc {
+	return func(s *breakerSettings) error {
+		if n <= 0 {
+			return errInvalidMinRequests
+		}
+		s.HalfOpenRequests = n
+		return nil
+	}
+}
+
+// breaker is the circuit breaker of a single host. Every change of state
+// starts a new generation, so that attempts allowed before the change don't
+// count towards the new state.
+type breaker struct {
+	settings *breakerSettings
+
+	mu         sync.Mutex
+	state      breakerState
+	generation uint64
+	since      time.Time
+	requests   int
+	failures   int
+	probes     int
+}
+
+func (b *breaker) setState(state breakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.since = now
+	b.requests, b.failures, b.probes = 0, 0, 0
+}
+
+// refresh moves an open breaker to half-open once the timeout elapsed, and
+// starts a new window of a closed one.
+func (b *breaker) refresh(now time.Time) {
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.since) >= b.settings.OpenTimeout {
+			b.setState(breakerHalfOpen, now)
+		}
+	case breakerClosed:
+		if now.Sub(b.since) >= b.settings.Window {
+			b.setState(breakerClosed, now)
+		}
+	}
+}
+
+// allow reports whether an attempt may be sent, and the generation its result belongs to.
+func (b *breaker) allow(now time.Time) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(now)
+	switch b.state {
+	case breakerOpen:
+		return 0, errCircuitOpen
+	case breakerHalfOpen:
+		if b.probes >= b.settings.HalfOpenRequests {
+			return 0, errCircuitOpen
+		}
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// record counts the result of an attempt allowed in generation.
+func (b *breaker) record(generation uint64, success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case breakerHalfOpen:
+		if success {
+			b.setState(breakerClosed, now)
+		} else {
+			b.setState(breakerOpen, now)
+		}
+	case breakerClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests && float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			b.setState(breakerOpen, now)
+		}
+	}
+}
+
+// release gives back the probe of an attempt allowed in generation whose
+// result says nothing about the host, so that a half-open breaker keeps probing.
+func (b *breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == breakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *breaker) currentState(now time.Time) breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(now)
+	return b.state
+}
+
+// hostBreakers keeps a circuit breaker per request host, so that a failing
+// site fails fast without stalling the requests to the others. It is
+// disabled while settings is nil.
+type hostBreakers struct {
+	clock    Clock
+	settings *breakerSettings
+
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+func newHostBreakers() *hostBreakers {
+	return &hostBreakers{
+		clock: defaultClock,
+		hosts: make(map[string]*breaker),
+	}
+}
+
+func (hb *hostBreakers) breakerFor(host string) *breaker {
+	host = normalizeHost(host)
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	b, ok := hb.hosts[host]
+	if !ok {
+		b = &breaker{settings: hb.settings, since: hb.clock.Now()}
+		hb.hosts[host] = b
+	}
+	return b
+}
+
+// WrapContext returns an ExecutableFunc which fails fast while the breaker of
+// host is open and records the results of op. Errors for which failed returns
+// false, and any result once ctx is done, are not recorded.
+func (hb *hostBreakers) WrapContext(ctx context.Context, host string, failed func(error) bool, op func() error) ExecutableFunc {
+	if hb.settings == nil {
+		return op
+	}
+
+	return func() error {
+		b := hb.breakerFor(host)
+		generation, err := b.allow(hb.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		err = op()
+		if ctx.Err() != nil || (err != nil && !failed(err)) {
+			b.release(generation)
+			return err
+		}
+		b.record(generation, err == nil, hb.clock.Now())
+		return err
+	}
+}
+
+// retryBudget limits the retries of the whole crawl to a ratio of its
+// requests, so that a failing site can't multiply the load. MinRetries
+// lets the first failures of a crawl be retried.
+type retryBudget struct {
+	ratio      float64
+	minRetries int64
+
+	requests atomic.Int64
+	retries  atomic.Int64
+}
+
+func newRetryBudget(ratio float64, minRetries int64) *retryBudget {
+	return &retryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+	}
+}
+
+func (rb *retryBudget) request() {
+	rb.requests.Add(1)
+}
+
+// withdraw takes a retry from the budget, reporting false once it's spent.
+func (rb *retryBudget) withdraw() bool {
+	for {
+		retries := rb.retries.Load()
+		allowed := rb.minRetries + int64(rb.ratio*float64(rb.requests.Load()))
+		if retries >= allowed {
+			return false
+		}
+		if rb.retries.CompareAndSwap(retries, retries+1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package remilia
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+func TestBreakerOptions(t *testing.T) {
+	testCases := []struct {
+		name string
+		opt  BreakerOptionFunc
+		err  error
+	}{
+		{"Failure ratio above one", WithBreakerFailureRatio(1.5), errInvalidFailureRatio},
+		{"Zero failure ratio", WithBreakerFailureRatio(0), errInvalidFailureRatio},
+		{"Zero min requests", WithBreakerMinRequests(0), errInvalidMinRequests},
+		{"Zero window", WithBreakerWindow(0), errInvalidBreakerTime},
+		{"Negative open timeout", WithBreakerOpenTimeout(-time.Second), errInvalidBreakerTime},
+		{"Zero half-open requests", WithBreakerHalfOpenRequests(0), errInvalidMinRequests},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, tc.opt(newBreakerSettings()), tc.err, "invalid settings should be rejected")
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	start := time.Unix(0, 0)
+	newTestBreaker := func() *breaker {
+		return &breaker{
+			settings: &breakerSettings{FailureRatio: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: 10 * time.Second, HalfOpenRequests: 1},
+			since:    start,
+		}
+	}
+	attempt := func(b *breaker, now time.Time, success bool) error {
+		generation, err := b.allow(now)
+		if err != nil {
+			return err
+		}
+		b.record(generation, success, now)
+		return nil
+	}
+
+	t.Run("Trip once the failure ratio is reached", func(t *testing.T) {
+		b := newTestBreaker()
+		for _, success := range []bool{false, false, true} {
+			assert.NoError(t, attempt(b, start, success), "attempts should be allowed while closed")
+		}
+		assert.Equal(t, breakerClosed, b.currentState(start), "breaker should wait for the min requests")
+
+		assert.NoError(t, attempt(b, start, false))
+		assert.Equal(t, breakerOpen, b.currentState(start), "breaker should trip at the failure ratio")
+		assert.ErrorIs(t, attempt(b, start, true), errCircuitOpen, "attempts should fail fast while open")
+	})
+
+	t.Run("Start a new window", func(t *testing.T) {
+		b := newTestBreaker()
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, attempt(b, start, false))
+		}
+
+		later := start.Add(time.Minute)
+		assert.NoError(t, attempt(b, later, false))
+		assert.Equal(t, breakerClosed, b.currentState(later), "failures of the previous window should not count")
+	})
+
+	t.Run("Probe the host once the open timeout elapsed", func(t *testing.T) {
+		b := newTestBreaker()
+		b.setState(breakerOpen, start)
+
+		later := start.Add(10 * time.Second)
+		assert.Equal(t, breakerHalfOpen, b.currentState(later), "breaker should be half-open after the timeout")
+
+		generation, err := b.allow(later)
+		assert.NoError(t, err, "a probe should be allowed")
+		_, err = b.allow(later)
+		assert.ErrorIs(t, err, errCircuitOpen, "only one probe should be in flight")
+
+		b.record(generation, true, later)
+		assert.Equal(t, breakerClosed, b.currentState(later), "a successful probe should close the breaker")
+	})
+
+	t.Run("Reopen on a failed probe", func(t *testing.T) {
+		b := newTestBreaker()
+		b.setState(breakerOpen, start)
+
+		later := start.Add(10 * time.Second)
+		assert.NoError(t, attempt(b, later, false))
+		assert.Equal(t, breakerOpen, b.currentState(later), "a failed probe should open the breaker again")
+	})
+
+	t.Run("Ignore results of a previous state", func(t *testing.T) {
+		b := newTestBreaker()
+		generation, _ := b.allow(start)
+		b.setState(breakerOpen, start)
+		b.setState(breakerHalfOpen, start)
+
+		b.record(generation, true, start)
+		assert.Equal(t, breakerHalfOpen, b.currentState(start), "a stale result should not close the breaker")
+	})
+}
+
+func TestHostBreakers(t *testing.T) {
+	newTestBreakers := func() *hostBreakers {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+
+		hb := newHostBreakers()
+		hb.clock = mockClock
+		hb.settings = &breakerSettings{FailureRatio: 1, MinRequests: 2, Window: time.Minute, OpenTimeout: time.Second, HalfOpenRequests: 1}
+		return hb
+	}
+
+	t.Run("Ignore results once the context is done", func(t *testing.T) {
+		hb := newTestBreakers()
+		ctx, cancel := context.WithCancel(context.Background())
+		op := hb.WrapContext(ctx, "example.com", isHostFailure, func() error {
+			cancel()
+			return assert.AnError
+		})
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, op(), assert.AnError, "the error of op should be returned")
+		}
+		assert.Equal(t, breakerClosed, hb.breakerFor("example.com").currentState(time.Unix(0, 0)), "cancelled attempts should not trip the breaker")
+	})
+
+	t.Run("Ignore failures of the proxy", func(t *testing.T) {
+		hb := newTestBreakers()
+		proxyURL, _ := url.Parse("http://127.0.0.1:1")
+		op := hb.WrapContext(context.Background(), "example.com", isHostFailure, func() error {
+			return proxyError(proxyURL, assert.AnError)
+		})
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, op(), errProxyFailed, "the error of op should be returned")
+		}
+		assert.Equal(t, breakerClosed, hb.breakerFor("example.com").currentState(time.Unix(0, 0)), "proxy failures should not trip the breaker")
+	})
+
+	t.Run("Give back the probe of an ignored attempt", func(t *testing.T) {
+		hb := newTestBreakers()
+		b := hb.breakerFor("example.com")
+		b.setState(breakerHalfOpen, time.Unix(0, 0))
+		op := hb.WrapContext(context.Background(), "example.com", isHostFailure, func() error {
+			return errNoProxyAvailable
+		})
+
+		assert.ErrorIs(t, op(), errNoProxyAvailable, "the probe should be sent")
+		assert.ErrorIs(t, op(), errNoProxyAvailable, "the probe should be sent again")
+		assert.Equal(t, breakerHalfOpen, b.currentState(time.Unix(0, 0)), "the breaker should keep probing")
+	})
+
+	t.Run("Trip on failures of the host", func(t *testing.T) {
+		hb := newTestBreakers()
+		op := hb.WrapContext(context.Background(), "example.com", isHostFailure, func() error {
+			return assert.AnError
+		})
+
+		assert.ErrorIs(t, op(), assert.AnError)
+		assert.ErrorIs(t, op(), assert.AnError)
+		assert.ErrorIs(t, op(), errCircuitOpen, "the breaker should trip")
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	rb := newRetryBudget(0.5, 1)
+
+	assert.True(t, rb.withdraw(), "min retries should be allowed before any request")
+	assert.False(t, rb.withdraw(), "budget should be spent")
+
+	rb.request()
+	rb.request()
+	assert.True(t, rb.withdraw(), "requests should add to the budget")
+	assert.False(t, rb.withdraw(), "budget should be spent")
+}
+
+func TestExecuteCircuitBreaker(t *testing.T) {
+	t.Run("Fail fast while the breaker is open", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+		mockClock.On("Sleep", mock.Anything).Return()
+
+		calls := 0
+		client, httpClient := setupClient(t,
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithClock(mockClock),
+			WithMinDelay(time.Millisecond),
+			WithMaxDelay(time.Millisecond),
+			WithMaxAttempt(5),
+			WithCircuitBreaker(WithBreakerMinRequests(2), WithBreakerFailureRatio(1)),
+		)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*fasthttp.Response).SetStatusCode(fasthttp.StatusServiceUnavailable)
+			calls++
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/")
+		_, err := client.execute(context.Background(), request)
+		assert.ErrorIs(t, err, errCircuitOpen, "retries should stop once the breaker trips")
+		assert.Equal(t, 2, calls, "the host should not be hit once the breaker is open")
+
+		other, _ := NewRequest("GET", "http://example.com/other")
+		_, err = client.execute(context.Background(), other)
+		assert.ErrorIs(t, err, errCircuitOpen, "requests to the host should fail fast")
+		assert.Equal(t, 2, calls, "the host should not be hit once the breaker is open")
+	})
+
+	t.Run("Stop retrying once the budget is spent", func(t *testing.T) {
+		calls := 0
+		client, httpClient := setupClient(t,
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithMinDelay(time.Millisecond),
+			WithMaxDelay(time.Millisecond),
+			WithMaxAttempt(5),
+			WithRetryBudget(0, 2),
+		)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*fasthttp.Response).SetStatusCode(fasthttp.StatusServiceUnavailable)
+			calls++
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/")
+		_, err := client.execute(context.Background(), request)
+		assert.Error(t, err, "err should not be nil")
+		assert.Equal(t, 3, calls, "only the budgeted retries should be sent")
+	})
+
+	t.Run("Only spend the budget on retries which are sent", func(t *testing.T) {
+		calls := 0
+		client, httpClient := setupClient(t,
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithMinDelay(time.Millisecond),
+			WithMaxDelay(time.Millisecond),
+			WithMaxAttempt(3),
+			WithRetryBudget(0, 5),
+		)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*fasthttp.Response).SetStatusCode(fasthttp.StatusServiceUnavailable)
+			calls++
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/")
+		_, err := client.execute(context.Background(), request)
+		assert.Error(t, err, "err should not be nil")
+		assert.Equal(t, 3, calls, "the request should be sent max attempt times")
+		assert.Equal(t, int64(2), client.retryBudget.retries.Load(), "the last attempt should not withdraw a retry")
+	})
+
+	t.Run("Failed to set a negative budget", func(t *testing.T) {
+		_, err := newClient(WithRetryBudget(-1, 0))
+		assert.ErrorIs(t, err, errInvalidRetryRatio, "err should be errInvalidRetryRatio")
+	})
+}
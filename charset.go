@@ -0,0 +1,31 @@
+package remilia
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// detectCharset returns the encoding of an HTML body, from its BOM, the
+// charset of contentType or its <meta charset> and http-equiv tags, in that
+// order. A body without any of them is UTF-8 if it is valid UTF-8, since
+// the windows-1252 fallback of the HTML spec only looks at the first 1024 bytes.
+func detectCharset(body []byte, contentType string) (encoding.Encoding, string) {
+	e, name, certain := charset.DetermineEncoding(body, contentType)
+	if !certain && name == "windows-1252" && utf8.Valid(body) {
+		return encoding.Nop, "utf-8"
+	}
+	return e, name
+}
+
+// charsetDecoder returns the transformer decoding body to UTF-8, or nil if it
+// is already UTF-8, along with the name of its charset.
+func charsetDecoder(body []byte, contentType string) (transform.Transformer, string) {
+	e, name := detectCharset(body, contentType)
+	if name == "utf-8" || e == encoding.Nop {
+		return nil, name
+	}
+	return e.NewDecoder(), name
+}
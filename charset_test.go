@@ -0,0 +1,81 @@
+package remilia
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func mustEncode(t *testing.T, e encoding.Encoding, s string) []byte {
+	encoded, err := e.NewEncoder().Bytes([]byte(s))
+	assert.NoError(t, err)
+	return encoded
+}
+
+func TestDetectCharset(t *testing.T) {
+	utf16BOM, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("<p>hi</p>"))
+
+	testCases := []struct {
+		name        string
+		body        []byte
+		contentType string
+		expected    string
+	}{
+		{"Content-Type header", mustEncode(t, simplifiedchinese.GBK, "<p>你好</p>"), "text/html; charset=gbk", "gbk"},
+		{"Byte order mark", utf16BOM, "text/html", "utf-16le"},
+		{"Meta charset", mustEncode(t, japanese.ShiftJIS, `<meta charset="shift_jis"><p>こんにちは</p>`), "text/html", "shift_jis"},
+		{"Meta http-equiv", []byte(`<meta http-equiv="Content-Type" content="text/html; charset=gb2312">`), "", "gbk"},
+		{"Header wins over meta", []byte(`<meta charset="shift_jis">`), "text/html; charset=utf-8", "utf-8"},
+		{"Undeclared UTF-8 after the prescan", []byte(strings.Repeat(" ", 2048) + "<p>héllo</p>"), "text/html", "utf-8"},
+		{"Undeclared legacy bytes", []byte("<p>caf\xe9</p>"), "text/html", "windows-1252"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, name := detectCharset(tc.body, tc.contentType)
+			assert.Equal(t, tc.expected, name, "charset should be detected")
+		})
+	}
+}
+
+func TestExecuteDecodesCharset(t *testing.T) {
+	respond := func(client *Client, httpClient *mockInternalClient, contentType string, body []byte) *Response {
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.Header.Set("Content-Type", contentType)
+			resp.SetBody(body)
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/")
+		response, err := client.execute(context.Background(), request)
+		assert.NoError(t, err)
+		return response
+	}
+
+	t.Run("Decode each response with its charset", func(t *testing.T) {
+		client, httpClient := setupClient(t)
+		gbk := respond(client, httpClient, "text/html; charset=gbk", mustEncode(t, simplifiedchinese.GBK, "<p>你好</p>"))
+		assert.Equal(t, "你好", gbk.Document().Find("p").Text(), "GBK should be decoded")
+		assert.Equal(t, "gbk", gbk.Charset, "the charset should be recorded")
+
+		client, httpClient = setupClient(t)
+		sjis := respond(client, httpClient, "text/html", mustEncode(t, japanese.ShiftJIS, `<meta charset="shift_jis"><p>こんにちは</p>`))
+		assert.Equal(t, "こんにちは", sjis.Document().Find("p").Text(), "Shift_JIS should be decoded")
+	})
+
+	t.Run("Explicit transformer overrides the detection", func(t *testing.T) {
+		client, httpClient := setupClient(t, WithTransformer(simplifiedchinese.GBK.NewDecoder()))
+		response := respond(client, httpClient, "text/html; charset=utf-8", mustEncode(t, simplifiedchinese.GBK, "<p>你好</p>"))
+
+		assert.Equal(t, "你好", response.Document().Find("p").Text(), "the transformer should decode the body")
+		assert.Empty(t, response.Charset, "no charset should be detected")
+	})
+}
@@ -1,6 +1,7 @@
 package remilia
 
 import (
+	"context"
 	"errors"
 	"io"
 	"testing"
@@ -26,6 +27,22 @@ func (m *mockInternalClient) Do(req *fasthttp.Request, resp *fasthttp.Response)
 	return args.Error(0)
 }
 
+// timeoutInternalClient records the timeouts every request is sent with.
+type timeoutInternalClient struct {
+	timeouts []Timeouts
+	uris     []string
+}
+
+func (c *timeoutInternalClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.DoTimeouts(req, resp, Timeouts{})
+}
+
+func (c *timeoutInternalClient) DoTimeouts(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts) error {
+	c.timeouts = append(c.timeouts, timeouts)
+	c.uris = append(c.uris, req.URI().String())
+	return nil
+}
+
 func TestNewClient(t *testing.T) {
 	t.Run("Successful build", func(t *testing.T) {
 		client, err := newClient(
@@ -87,6 +104,64 @@ func TestNewClient(t *testing.T) {
 		assert.Equal(t, errInvalidTimeout, err, "Error should be ErrInvalidTimeout")
 	})
 
+	t.Run("Successful build applies rate limit options", func(t *testing.T) {
+		clock := new(mockClock)
+		clock.On("Now").Return(time.Unix(0, 0))
+
+		client, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			WithInitiallyAvailToken(3),
+			WithCapacity(5),
+			WithFillInterval(time.Minute),
+			WithFillQuantum(2),
+			WithClock(clock),
+		)
+
+		assert.NoError(t, err, "newClient should not return error")
+		assert.Equal(t, int64(5), client.rateLimitation.capacity, "Capacity should be applied")
+		assert.Equal(t, time.Minute, client.rateLimitation.fillInterval, "Fill interval should be applied")
+		assert.Equal(t, int64(2), client.rateLimitation.fillQuantum, "Fill quantum should be applied")
+		assert.Equal(t, int64(3), client.rateLimitation.initAvailToken, "Initially available token should be applied")
+		assert.Equal(t, clock, client.rateLimitation.clock, "Clock should be applied")
+	})
+
+	t.Run("Successful build applies backoff options to pooled backoffs", func(t *testing.T) {
+		client, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			WithMaxAttempt(2),
+			WithLinearAttempt(1),
+		)
+		assert.NoError(t, err, "newClient should not return error")
+
+		eb := client.exponentialBackoffPool.get()
+		assert.Equal(t, uint8(2), eb.GetMaxAttempt(), "Pooled backoff should use the configured max attempt")
+		assert.Equal(t, uint8(1), eb.linearAttempt, "Pooled backoff should use the configured linear attempt")
+	})
+
+	t.Run("Failed to build with initially available token above the capacity", func(t *testing.T) {
+		client, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			WithInitiallyAvailToken(10),
+			WithCapacity(5),
+		)
+
+		assert.Nil(t, client, "Client should be nil")
+		assert.Equal(t, errInvalidInitAvailToken, err, "Error should be errInvalidInitAvailToken")
+	})
+
+	t.Run("Failed to build with a relative base url", func(t *testing.T) {
+		_, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			WithBaseURL("/relative"),
+		)
+
+		assert.Equal(t, errInvalidBaseURL, err, "Error should be errInvalidBaseURL")
+	})
+
 	t.Run("Successful build with valid options", func(t *testing.T) {
 		client, err := newClient(
 			withInternalClient(new(mockInternalClient)),
@@ -129,7 +204,7 @@ func assertExecuteSuccess(t *testing.T, client *Client, httpClient *mockInternal
 		Headers:     fasthttp.AcquireArgs(),
 		QueryParams: fasthttp.AcquireArgs(),
 	}
-	response, err := client.execute(request)
+	response, err := client.execute(context.Background(), request)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, response)
@@ -146,7 +221,7 @@ func assertExecuteFailure(t *testing.T, client *Client, httpClient *mockInternal
 		Headers:     fasthttp.AcquireArgs(),
 		QueryParams: fasthttp.AcquireArgs(),
 	}
-	response, err := client.execute(request)
+	response, err := client.execute(context.Background(), request)
 
 	assert.Nil(t, response)
 	assert.Error(t, err)
@@ -175,6 +250,218 @@ func TestExecute(t *testing.T) {
 		})
 	})
 
+	t.Run("Successful execute exposes response metadata", func(t *testing.T) {
+		client, httpClient := setupClient(t)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.SetStatusCode(fasthttp.StatusCreated)
+			resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+			resp.Header.Set("X-Test", "remilia")
+			resp.SetBody([]byte("<html><body><p>mock response</p></body></html>"))
+		}).Return(nil)
+
+		request, _ := newRequest(withURL("http://example.com/page"))
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Same(t, request, response.Request, "Response should keep the originating request")
+		assert.Equal(t, fasthttp.StatusCreated, response.StatusCode, "StatusCode should be copied")
+		assert.Equal(t, "text/html; charset=utf-8", response.ContentType(), "Content-Type should be copied")
+		assert.Equal(t, "remilia", response.Header.Get("X-Test"), "Headers should be copied")
+		assert.Equal(t, "http://example.com/page", response.URL, "URL should be the effective URL")
+		assert.Equal(t, []byte("<html><body><p>mock response</p></body></html>"), response.Body, "Body should be copied")
+		assert.Equal(t, 1, response.Attempts, "Attempts should be 1")
+		assert.Equal(t, "mock response", response.Document().Find("p").Text(), "Document should be parsed from the body")
+		assert.False(t, response.Timing.Start.IsZero(), "Timing should record the start time")
+		assert.GreaterOrEqual(t, response.Timing.Total, response.Timing.Transfer, "Total should include the transfer")
+		httpClient.AssertExpectations(t)
+	})
+
+	t.Run("Successful execute honors timeouts and base url", func(t *testing.T) {
+		internal := &timeoutInternalClient{}
+		client, err := newClient(
+			withInternalClient(internal),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			WithBaseURL("http://example.com/docs/"),
+			WithTimeouts(Timeouts{Connect: time.Second, FirstByte: 2 * time.Second}),
+			WithTimeout(5*time.Second),
+		)
+		assert.NoError(t, err)
+
+		relative, _ := NewRequest("GET", "page?id=1")
+		_, err = client.execute(context.Background(), relative)
+		assert.NoError(t, err)
+
+		absolute, _ := NewRequest("GET", "http://other.com/", WithRequestTimeouts(Timeouts{Total: time.Second}))
+		_, err = client.execute(context.Background(), absolute)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"http://example.com/docs/page?id=1", "http://other.com/"}, internal.uris, "Relative URLs should be resolved against the base url")
+		assert.Equal(t, "http://example.com/docs/page?id=1", string(relative.URL), "The request should keep the resolved URL")
+		assert.Equal(t, []Timeouts{
+			{Connect: time.Second, FirstByte: 2 * time.Second, Total: 5 * time.Second},
+			{Connect: time.Second, FirstByte: 2 * time.Second, Total: time.Second},
+		}, internal.timeouts, "Request timeouts should override the client ones")
+	})
+
+	t.Run("Successful execute keeps cookies per session", func(t *testing.T) {
+		client, httpClient := setupClient(t)
+
+		var sent []string
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			sent = append(sent, string(req.Header.Peek("Cookie")))
+			if len(req.Header.Peek("Cookie")) == 0 {
+				resp.Header.Add("Set-Cookie", "sid="+string(req.URI().QueryArgs().Peek("user"))+"; Path=/")
+			}
+		}).Return(nil)
+
+		for _, session := range []string{"alice", "bob", "alice", ""} {
+			request, _ := NewRequest("GET", "http://example.com/login", WithRequestQueryParam("user", session), WithRequestSession(session))
+			_, err := client.execute(context.Background(), request)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"", "", "sid=alice", ""}, sent, "Each session should only send its own cookies")
+	})
+
+	t.Run("Successful execute follows redirects", func(t *testing.T) {
+		client, httpClient := setupClient(t, withClientLogger(&defaultLogger{internal: zap.NewNop()}))
+
+		var sent []string
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			sent = append(sent, string(req.Header.Method())+" "+req.URI().String()+" "+string(req.Header.Peek("Cookie")))
+			switch string(req.URI().Path()) {
+			case "/old":
+				resp.SetStatusCode(fasthttp.StatusFound)
+				resp.Header.Set("Location", "/new?page=1")
+				resp.Header.Add("Set-Cookie", "sid=1; Path=/")
+			default:
+				resp.SetStatusCode(fasthttp.StatusOK)
+				resp.SetBody([]byte("<p>new</p>"))
+			}
+		}).Return(nil)
+
+		request, _ := NewRequest("POST", "http://example.com/old", WithRequestBody([]byte("payload"), "text/plain"))
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"POST http://example.com/old ",
+			"GET http://example.com/new?page=1 sid=1",
+		}, sent, "A 302 should be followed with a GET carrying the cookies it set")
+		assert.Equal(t, fasthttp.StatusOK, response.StatusCode, "The final response should be returned")
+		assert.Equal(t, "http://example.com/new?page=1", response.URL, "URL should be the effective URL")
+		assert.Equal(t, "new", response.Document().Find("p").Text(), "The final body should be parsed")
+	})
+
+	t.Run("Failed execute after too many redirects", func(t *testing.T) {
+		client, httpClient := setupClient(t, withClientLogger(&defaultLogger{internal: zap.NewNop()}), WithMaxRedirects(2))
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.SetStatusCode(fasthttp.StatusMovedPermanently)
+			resp.Header.Set("Location", "/loop")
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/loop")
+		_, err := client.execute(context.Background(), request)
+
+		assert.ErrorIs(t, err, errTooManyRedirects, "Redirect loops should fail")
+		httpClient.AssertNumberOfCalls(t, "Do", 3)
+	})
+
+	t.Run("Failed execute after a redirect to a disallowed host", func(t *testing.T) {
+		client, httpClient := setupClient(t, withClientLogger(&defaultLogger{internal: zap.NewNop()}), WithRobotsTxt("remilia"))
+
+		var sent []string
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			sent = append(sent, req.URI().String())
+			switch req.URI().String() {
+			case "http://example.com/robots.txt":
+				resp.SetStatusCode(fasthttp.StatusNotFound)
+			case "http://other.com/robots.txt":
+				resp.SetStatusCode(fasthttp.StatusOK)
+				resp.SetBody([]byte("User-agent: *\nDisallow: /private"))
+			case "http://example.com/old":
+				resp.SetStatusCode(fasthttp.StatusFound)
+				resp.Header.Set("Location", "http://other.com/private")
+			default:
+				resp.SetStatusCode(fasthttp.StatusOK)
+			}
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/old")
+		_, err := client.execute(context.Background(), request)
+
+		assert.ErrorIs(t, err, errDisallowedByRobots, "The redirect should be dropped")
+		assert.Equal(t, []string{
+			"http://example.com/robots.txt",
+			"http://example.com/old",
+			"http://other.com/robots.txt",
+		}, sent, "The disallowed location should not be fetched nor retried")
+	})
+
+	t.Run("Successful retry starts over from the request URL", func(t *testing.T) {
+		client, httpClient := setupClient(t,
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithMinDelay(time.Millisecond),
+			WithMaxDelay(time.Millisecond),
+		)
+
+		var sent []string
+		failed := false
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			sent = append(sent, string(req.Header.Method())+" "+req.URI().String())
+			switch {
+			case string(req.URI().Path()) == "/old":
+				resp.SetStatusCode(fasthttp.StatusSeeOther)
+				resp.Header.Set("Location", "/new")
+			case !failed:
+				failed = true
+				resp.SetStatusCode(fasthttp.StatusServiceUnavailable)
+			default:
+				resp.SetStatusCode(fasthttp.StatusOK)
+			}
+		}).Return(nil)
+
+		request, _ := NewRequest("POST", "http://example.com/old", WithRequestBody([]byte("payload"), "text/plain"))
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"POST http://example.com/old",
+			"GET http://example.com/new",
+			"POST http://example.com/old",
+			"GET http://example.com/new",
+		}, sent, "The retry should resend the original request")
+		assert.Equal(t, "http://example.com/new", response.URL, "URL should be the effective URL")
+		assert.Equal(t, 2, response.Attempts, "Attempts should be 2")
+	})
+
+	t.Run("Successful execute leaves redirects to the layers when disabled", func(t *testing.T) {
+		client, httpClient := setupClient(t, WithMaxRedirects(0))
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.SetStatusCode(fasthttp.StatusFound)
+			resp.Header.Set("Location", "/new")
+		}).Return(nil).Once()
+
+		request, _ := NewRequest("GET", "http://example.com/old")
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, fasthttp.StatusFound, response.StatusCode, "The redirect should be returned")
+		assert.Equal(t, "http://example.com/old", response.URL, "URL should be the request URL")
+		httpClient.AssertExpectations(t)
+	})
+
 	// TODO: figure out why this test needs much time
 	//t.Run("Failed to send request", func(t *testing.T) {
 	//	core, recorded := observer.New(zap.DebugLevel)
@@ -187,7 +474,7 @@ func TestExecute(t *testing.T) {
 	//	httpClient.On("Do", mock.Anything, mock.Anything).Return(errors.New("test network error"))
 	//
 	//	request := &Request{}
-	//	response, err := client.execute(request)
+	//	response, err := client.execute(context.Background(), request)
 	//
 	//	assert.Nil(t, response, "Response should be nil")
 	//	assert.Error(t, err, "NewClient should return error")
@@ -226,7 +513,7 @@ func TestExecute(t *testing.T) {
 			Headers:     fasthttp.AcquireArgs(),
 			QueryParams: fasthttp.AcquireArgs(),
 		}
-		response, err := client.execute(request)
+		response, err := client.execute(context.Background(), request)
 
 		assert.Nil(t, response, "Response should be nil")
 		assert.Error(t, err, "NewClient should return error")
@@ -323,3 +610,178 @@ func TestExecute(t *testing.T) {
 		})
 	})
 }
+
+func TestExecuteRetryPolicy(t *testing.T) {
+	respond := func(codes ...int) (*Client, *int) {
+		calls := 0
+		client, httpClient := setupClient(t,
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithMinDelay(time.Millisecond),
+			WithMaxDelay(time.Millisecond),
+			WithMaxAttempt(3),
+		)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			if calls < len(codes) {
+				resp.SetStatusCode(codes[calls])
+			}
+			calls++
+		}).Return(nil)
+		return client, &calls
+	}
+
+	t.Run("Retry server errors", func(t *testing.T) {
+		client, calls := respond(fasthttp.StatusServiceUnavailable, fasthttp.StatusOK)
+		request, _ := NewRequest("GET", "http://example.com/")
+
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, fasthttp.StatusOK, response.StatusCode, "the retried response should be returned")
+		assert.Equal(t, 2, *calls, "the request should be sent twice")
+		assert.Equal(t, 2, response.Attempts, "Attempts should be 2")
+	})
+
+	t.Run("Never retry not found", func(t *testing.T) {
+		client, calls := respond(fasthttp.StatusNotFound)
+		request, _ := NewRequest("GET", "http://example.com/")
+
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, fasthttp.StatusNotFound, response.StatusCode, "the response should be returned")
+		assert.Equal(t, 1, *calls, "the request should be sent once")
+	})
+
+	t.Run("Fail once the retries are exhausted", func(t *testing.T) {
+		client, calls := respond(fasthttp.StatusTooManyRequests)
+		request, _ := NewRequest("GET", "http://example.com/")
+
+		_, err := client.execute(context.Background(), request)
+
+		assert.Error(t, err, "err should not be nil")
+		assert.Equal(t, 3, *calls, "the request should be sent max attempt times")
+	})
+
+	t.Run("Honor the budget of the request", func(t *testing.T) {
+		client, calls := respond(fasthttp.StatusBadGateway)
+		request, _ := NewRequest("GET", "http://example.com/", WithRequestMaxAttempts(1))
+
+		_, err := client.execute(context.Background(), request)
+
+		assert.Error(t, err, "err should not be nil")
+		assert.Equal(t, 1, *calls, "the request should be sent once")
+	})
+
+	t.Run("Use a custom policy", func(t *testing.T) {
+		calls := 0
+		var attempts []RetryAttempt
+		client, httpClient := setupClient(t, WithMinDelay(time.Millisecond), WithRetryPolicy(RetryPolicyFunc(func(attempt RetryAttempt) (bool, time.Duration) {
+			attempts = append(attempts, attempt)
+			return attempt.Header.Get("X-Retry") == "yes", 0
+		})))
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.Reset()
+			if calls == 0 {
+				resp.Header.Set("X-Retry", "yes")
+			}
+			calls++
+		}).Return(nil)
+		request, _ := NewRequest("GET", "http://example.com/")
+
+		_, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls, "the request should be retried when the policy says so")
+		assert.Equal(t, []uint8{1, 2}, []uint8{attempts[0].Attempt, attempts[1].Attempt}, "the policy should see the attempt number")
+	})
+
+	t.Run("Failed to set a nil policy", func(t *testing.T) {
+		_, err := newClient(WithRetryPolicy(nil))
+		assert.ErrorIs(t, err, errInvalidRetryPolicy, "err should be errInvalidRetryPolicy")
+	})
+}
+
+func TestExecuteRateLimit(t *testing.T) {
+	setup := func(opts ...ClientOptionFunc) (*Client, *mockClock) {
+		clock := new(mockClock)
+		clock.On("Now").Return(time.Unix(0, 0))
+		clock.On("Sleep", mock.Anything).Return()
+
+		client, httpClient := setupClient(t, append([]ClientOptionFunc{WithClock(clock)}, opts...)...)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*fasthttp.Response).SetStatusCode(fasthttp.StatusOK)
+		}).Return(nil)
+		return client, clock
+	}
+
+	t.Run("Hosts do not share a bucket by default", func(t *testing.T) {
+		client, clock := setup()
+
+		for _, host := range []string{"http://a.example.com/", "http://b.example.com/"} {
+			for i := int64(0); i < defaultCapacity; i++ {
+				request, _ := NewRequest("GET", host)
+				_, err := client.execute(context.Background(), request)
+				assert.NoError(t, err)
+			}
+		}
+
+		assert.Nil(t, client.rateLimitation, "the crawl-wide bucket should not be built")
+		clock.AssertNotCalled(t, "Sleep", mock.Anything)
+	})
+
+	t.Run("Hosts share the crawl-wide bucket once it is configured", func(t *testing.T) {
+		client, clock := setup(WithCapacity(1))
+
+		for _, host := range []string{"http://a.example.com/", "http://b.example.com/"} {
+			request, _ := NewRequest("GET", host)
+			_, err := client.execute(context.Background(), request)
+			assert.NoError(t, err)
+		}
+
+		clock.AssertCalled(t, "Sleep", defaultFillInterval)
+	})
+
+	t.Run("Redirects to another host wait for its limiter", func(t *testing.T) {
+		clock := new(mockClock)
+		clock.On("Now").Return(time.Unix(0, 0))
+		clock.On("Sleep", mock.Anything).Return()
+
+		client, httpClient := setupClient(t, WithClock(clock), WithDomainLimit("other.com", WithLimitDelay(time.Minute)))
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			if string(req.URI().Host()) == "example.com" {
+				resp.SetStatusCode(fasthttp.StatusFound)
+				resp.Header.Set("Location", "http://other.com/new")
+				return
+			}
+			resp.SetStatusCode(fasthttp.StatusOK)
+		}).Return(nil)
+
+		for _, target := range []string{"http://other.com/", "http://example.com/old"} {
+			request, _ := NewRequest("GET", target)
+			_, err := client.execute(context.Background(), request)
+			assert.NoError(t, err)
+		}
+
+		clock.AssertCalled(t, "Sleep", time.Minute)
+	})
+}
+
+func TestWithJitter(t *testing.T) {
+	t.Run("Successfully select a strategy", func(t *testing.T) {
+		client, err := newClient(WithJitter(ConstantBackoff), WithMinDelay(time.Millisecond))
+		assert.NoError(t, err)
+
+		eb := client.exponentialBackoffPool.get()
+		assert.Equal(t, ConstantBackoff, eb.jitter, "pooled backoffs should use the strategy")
+		assert.Equal(t, time.Millisecond, eb.Next(), "the constant delay should be the min delay")
+	})
+
+	t.Run("Failed to select an unknown strategy", func(t *testing.T) {
+		_, err := newClient(WithJitter(JitterStrategy(-1)))
+		assert.ErrorIs(t, err, errInvalidJitterStrategy, "err should be errInvalidJitterStrategy")
+	})
+}
@@ -45,13 +45,12 @@ func work() {
 	)
 
 	initURL := "http://localhost:6657/page/1"
-	baseURL := "http://localhost:6657"
 
 	firstParser := func(in *goquery.Document, put remilia.Put[string]) {
 		in.Find("a").Each(func(i int, s *goquery.Selection) {
 			href, ok := s.Attr("href")
 			if ok {
-				put(baseURL + href)
+				put(href)
 			}
 		})
 	}
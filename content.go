@@ -0,0 +1,169 @@
+package remilia
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// ContentKind is how the body of a response was parsed, decided from its Content-Type.
+type ContentKind int
+
+const (
+	// HTMLContent bodies are parsed into a goquery document. Plain text and
+	// responses without a Content-Type, sniffed as text, are parsed as HTML too.
+	HTMLContent ContentKind = iota
+	// JSONContent bodies are decoded into a generic value.
+	JSONContent
+	// XMLContent bodies, including RSS and Atom feeds, are parsed into an XML tree.
+	XMLContent
+	// BinaryContent bodies, e.g. images and PDFs, are left raw in Body.
+	BinaryContent
+)
+
+func (k ContentKind) String() string {
+	switch k {
+	case HTMLContent:
+		return "html"
+	case JSONContent:
+		return "json"
+	case XMLContent:
+		return "xml"
+	default:
+		return "binary"
+	}
+}
+
+// contentKind returns how a body with contentType is parsed.
+func contentKind(contentType string, body []byte) ContentKind {
+	if strings.TrimSpace(contentType) == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return HTMLContent
+	case mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json"):
+		return JSONContent
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return XMLContent
+	case strings.HasPrefix(mediaType, "text/"):
+		return HTMLContent
+	default:
+		return BinaryContent
+	}
+}
+
+// decodeJSON decodes body into a generic value, keeping numbers as json.Number
+// so that large integers don't lose precision.
+func decodeJSON(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// XMLNode is an element of an XML tree.
+type XMLNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Children []*XMLNode
+	// Text is the character data directly inside the element, trimmed of surrounding space.
+	Text string
+}
+
+// Attr returns the value of the attribute with the local name name.
+func (n *XMLNode) Attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Find returns the descendants with the local name name, in document order.
+func (n *XMLNode) Find(name string) []*XMLNode {
+	var found []*XMLNode
+	for _, child := range n.Children {
+		if child.Name.Local == name {
+			found = append(found, child)
+		}
+		found = append(found, child.Find(name)...)
+	}
+	return found
+}
+
+var errEmptyXML = errors.New("xml document has no root element")
+
+// parseXML parses body into a tree. Encodings declared by the document are
+// decoded, and HTML entities, common in feeds, are accepted.
+func parseXML(body []byte) (*XMLNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var root *XMLNode
+	var stack []*XMLNode
+	var text []*strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &XMLNode{Name: t.Name, Attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+			text = append(text, &strings.Builder{})
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			stack[len(stack)-1].Text = strings.TrimSpace(text[len(text)-1].String())
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1].Write(t)
+			}
+		}
+	}
+
+	// Elements left open by a truncated document keep their text
+	for i, node := range stack {
+		node.Text = strings.TrimSpace(text[i].String())
+	}
+
+	if root == nil {
+		return nil, errEmptyXML
+	}
+	return root, nil
+}
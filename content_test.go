@@ -0,0 +1,151 @@
+package remilia
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+func TestContentKind(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		body        string
+		expected    ContentKind
+	}{
+		{"text/html; charset=utf-8", "", HTMLContent},
+		{"application/xhtml+xml", "", HTMLContent},
+		{"text/plain", "", HTMLContent},
+		{"", "<html><body></body></html>", HTMLContent},
+		{"application/json", "", JSONContent},
+		{"application/ld+json; charset=utf-8", "", JSONContent},
+		{"application/rss+xml", "", XMLContent},
+		{"text/xml", "", XMLContent},
+		{"image/png", "", BinaryContent},
+		{"application/pdf", "", BinaryContent},
+		{"", "%PDF-1.4", BinaryContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.contentType+tc.body, func(t *testing.T) {
+			assert.Equal(t, tc.expected, contentKind(tc.contentType, []byte(tc.body)), "the kind should match the content type")
+		})
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	t.Run("Parse a feed", func(t *testing.T) {
+		root, err := parseXML([]byte(`<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>News &amp; views</title>
+    <item><title>First&nbsp;post</title><link>http://example.com/1</link></item>
+    <item><title>Second</title><link>http://example.com/2</link></item>
+  </channel>
+</rss>`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "rss", root.Name.Local, "the root should be the rss element")
+		assert.Equal(t, "2.0", root.Attr("version"), "attributes should be kept")
+		assert.Equal(t, "News & views", root.Find("channel")[0].Children[0].Text, "entities should be decoded")
+
+		items := root.Find("item")
+		assert.Len(t, items, 2, "every item should be found")
+		assert.Equal(t, "First post", items[0].Find("title")[0].Text, "HTML entities should be accepted")
+		assert.Equal(t, "http://example.com/2", items[1].Find("link")[0].Text, "text should be kept per element")
+	})
+
+	t.Run("Decode the declared encoding", func(t *testing.T) {
+		root, err := parseXML([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><title>caf\xe9</title>"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "café", root.Text, "the body should be decoded")
+	})
+
+	t.Run("Fail without a root element", func(t *testing.T) {
+		_, err := parseXML([]byte("   "))
+		assert.ErrorIs(t, err, errEmptyXML)
+	})
+}
+
+func TestExecuteDispatchesContentType(t *testing.T) {
+	respond := func(t *testing.T, contentType string, body []byte) (*Response, error) {
+		client, httpClient := setupClient(t, withClientLogger(&defaultLogger{internal: zap.NewNop()}))
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.Header.Set("Content-Type", contentType)
+			resp.SetBody(body)
+		}).Return(nil)
+
+		request, _ := NewRequest("GET", "http://example.com/")
+		return client.execute(context.Background(), request)
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		response, err := respond(t, "application/json", []byte(`{"items":[{"id":9007199254740993}]}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, JSONContent, response.Kind)
+		assert.Nil(t, response.Document(), "JSON should not be parsed as HTML")
+		items := response.JSON().(map[string]any)["items"].([]any)
+		assert.Equal(t, json.Number("9007199254740993"), items[0].(map[string]any)["id"], "numbers should keep their precision")
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		response, err := respond(t, "application/atom+xml", []byte(`<feed><entry><title>a</title></entry></feed>`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, XMLContent, response.Kind)
+		assert.Equal(t, "a", response.XML().Find("title")[0].Text, "the feed should be parsed")
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		body := []byte{0x89, 'P', 'N', 'G', 0, 1, 2}
+		response, err := respond(t, "image/png", body)
+
+		assert.NoError(t, err)
+		assert.Equal(t, BinaryContent, response.Kind)
+		assert.Nil(t, response.Document(), "images should not be parsed")
+		assert.Nil(t, response.JSON(), "images should not be decoded")
+		assert.Equal(t, body, response.Body, "the raw body should be kept")
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		response, err := respond(t, "application/json", []byte(`{"items":`))
+
+		assert.NoError(t, err, "the response should not be dropped")
+		assert.Equal(t, JSONContent, response.Kind)
+		assert.Error(t, response.ParseErr, "the decoding error should be kept")
+		assert.Nil(t, response.JSON(), "nothing should be decoded")
+		assert.Equal(t, []byte(`{"items":`), response.Body, "the raw body should be kept")
+	})
+
+	t.Run("Empty JSON", func(t *testing.T) {
+		response, err := respond(t, "application/json", nil)
+
+		assert.NoError(t, err, "the response should not be dropped")
+		assert.Equal(t, fasthttp.StatusOK, response.StatusCode)
+		assert.NoError(t, response.ParseErr, "an empty body should not be decoded")
+		assert.Nil(t, response.JSON(), "nothing should be decoded")
+	})
+
+	t.Run("Malformed XML", func(t *testing.T) {
+		response, err := respond(t, "application/xml", []byte(`<feed><entry>`))
+
+		assert.NoError(t, err, "the response should not be dropped")
+		assert.Error(t, response.ParseErr, "the decoding error should be kept")
+		assert.Nil(t, response.XML(), "nothing should be decoded")
+	})
+
+	t.Run("Empty XML", func(t *testing.T) {
+		response, err := respond(t, "text/xml", []byte("  "))
+
+		assert.NoError(t, err, "the response should not be dropped")
+		assert.NoError(t, response.ParseErr, "an empty body should not be decoded")
+		assert.Nil(t, response.XML(), "nothing should be decoded")
+	})
+}
@@ -0,0 +1,386 @@
+package remilia
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errInvalidCookieLine = errors.New("invalid cookies.txt line")
+
+// httpOnlyPrefix marks HttpOnly cookies in a Netscape cookies.txt file.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// cookieEntry is a cookie stored in a jar, see RFC 6265 section 5.3.
+type cookieEntry struct {
+	name       string
+	value      string
+	domain     string
+	path       string
+	expires    time.Time
+	persistent bool
+	hostOnly   bool
+	secure     bool
+	httpOnly   bool
+	creation   time.Time
+	// seq orders cookies created within the same clock tick.
+	seq uint64
+}
+
+func (e *cookieEntry) key() string {
+	return e.domain + ";" + e.path + ";" + e.name
+}
+
+func (e *cookieEntry) expired(now time.Time) bool {
+	return e.persistent && !e.expires.After(now)
+}
+
+func (e *cookieEntry) matches(u *url.URL, now time.Time) bool {
+	if e.expired(now) {
+		return false
+	}
+	if e.secure && u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if e.hostOnly {
+		if host != e.domain {
+			return false
+		}
+	} else if !domainMatch(host, e.domain) {
+		return false
+	}
+
+	return pathMatch(requestPath(u), e.path)
+}
+
+// CookieJar stores cookies following the domain, path and expiry rules of
+// RFC 6265. It implements http.CookieJar and is safe for concurrent use.
+// Public suffixes are not checked, so a server can set a cookie for its whole TLD.
+type CookieJar struct {
+	mu      sync.Mutex
+	entries map[string]*cookieEntry
+	seq     uint64
+	now     func() time.Time
+}
+
+func NewCookieJar() *CookieJar {
+	return &CookieJar{
+		entries: make(map[string]*cookieEntry),
+		now:     time.Now,
+	}
+}
+
+// SetCookies stores the cookies received in a response to u.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	for _, cookie := range cookies {
+		entry, ok := newCookieEntry(u, cookie, now)
+		if !ok {
+			continue
+		}
+
+		key := entry.key()
+		if old, ok := j.entries[key]; ok {
+			entry.creation = old.creation
+			entry.seq = old.seq
+		} else {
+			j.seq++
+			entry.seq = j.seq
+		}
+
+		if entry.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+		j.entries[key] = entry
+	}
+}
+
+// Cookies returns the cookies to send in a request to u, longer paths first.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	var matched []*cookieEntry
+	for key, entry := range j.entries {
+		if entry.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if entry.matches(u, now) {
+			matched = append(matched, entry)
+		}
+	}
+
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].path) != len(matched[b].path) {
+			return len(matched[a].path) > len(matched[b].path)
+		}
+		if !matched[a].creation.Equal(matched[b].creation) {
+			return matched[a].creation.Before(matched[b].creation)
+		}
+		return matched[a].seq < matched[b].seq
+	})
+
+	cookies := make([]*http.Cookie, len(matched))
+	for i, entry := range matched {
+		cookies[i] = &http.Cookie{Name: entry.name, Value: entry.value}
+	}
+	return cookies
+}
+
+// newCookieEntry applies the storage model of RFC 6265 section 5.3 to a cookie
+// received from u. It reports false when the cookie has to be ignored.
+func newCookieEntry(u *url.URL, cookie *http.Cookie, now time.Time) (*cookieEntry, bool) {
+	host := strings.ToLower(u.Hostname())
+	entry := &cookieEntry{
+		name:     cookie.Name,
+		value:    cookie.Value,
+		secure:   cookie.Secure,
+		httpOnly: cookie.HttpOnly,
+		creation: now,
+	}
+
+	switch {
+	case cookie.MaxAge < 0:
+		entry.persistent = true
+		entry.expires = time.Unix(0, 0)
+	case cookie.MaxAge > 0:
+		entry.persistent = true
+		entry.expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !cookie.Expires.IsZero():
+		entry.persistent = true
+		entry.expires = cookie.Expires
+	}
+
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	if domain == "" {
+		entry.hostOnly = true
+		entry.domain = host
+	} else {
+		if !domainMatch(host, domain) {
+			return nil, false
+		}
+		entry.domain = domain
+	}
+
+	if cookie.Path != "" && strings.HasPrefix(cookie.Path, "/") {
+		entry.path = cookie.Path
+	} else {
+		entry.path = defaultCookiePath(u)
+	}
+
+	if entry.secure && u.Scheme != "https" {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// domainMatch implements the domain matching of RFC 6265 section 5.1.3.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	return strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch implements the path matching of RFC 6265 section 5.1.4.
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+func requestPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// defaultCookiePath returns the directory of the request path, see RFC 6265 section 5.1.4.
+func defaultCookiePath(u *url.URL) string {
+	p := u.Path
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// Export writes the persistent and session cookies of the jar in the Netscape
+// cookies.txt format. Session cookies are written with an expiry of 0.
+func (j *CookieJar) Export(w io.Writer) error {
+	j.mu.Lock()
+	entries := make([]*cookieEntry, 0, len(j.entries))
+	now := j.now()
+	for _, entry := range j.entries {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	j.mu.Unlock()
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].key() < entries[b].key()
+	})
+
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString("# Netscape HTTP Cookie File\n"); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		domain := entry.domain
+		if !entry.hostOnly {
+			domain = "." + domain
+		}
+		if entry.httpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+
+		var expires int64
+		if entry.persistent {
+			expires = entry.expires.Unix()
+		}
+
+		_, err := fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!entry.hostOnly), entry.path, netscapeBool(entry.secure), expires, entry.name, entry.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Import adds the cookies of a Netscape cookies.txt file to the jar.
+// Expired cookies are skipped.
+func (j *CookieJar) Import(r io.Reader) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%w: %q", errInvalidCookieLine, line)
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %q", errInvalidCookieLine, line)
+		}
+
+		entry := &cookieEntry{
+			name:     fields[5],
+			value:    fields[6],
+			domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			path:     fields[2],
+			hostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			secure:   strings.EqualFold(fields[3], "TRUE"),
+			httpOnly: httpOnly,
+			creation: now,
+		}
+		if expires > 0 {
+			entry.persistent = true
+			entry.expires = time.Unix(expires, 0)
+		}
+
+		if entry.expired(now) {
+			continue
+		}
+		j.seq++
+		entry.seq = j.seq
+		j.entries[entry.key()] = entry
+	}
+
+	return scanner.Err()
+}
+
+// sessionJars holds the default jar of a client and the jars of its sessions.
+type sessionJars struct {
+	mu       sync.Mutex
+	jar      *CookieJar
+	sessions map[string]*CookieJar
+}
+
+func newSessionJars(jar *CookieJar) *sessionJars {
+	return &sessionJars{
+		jar:      jar,
+		sessions: make(map[string]*CookieJar),
+	}
+}
+
+// jarFor returns the jar of session, creating it on first use. The empty
+// session is the default jar.
+func (s *sessionJars) jarFor(session string) *CookieJar {
+	if session == "" {
+		return s.jar
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jar, ok := s.sessions[session]
+	if !ok {
+		jar = NewCookieJar()
+		s.sessions[session] = jar
+	}
+	return jar
+}
+
+func (s *sessionJars) set(session string, jar *CookieJar) {
+	if session == "" {
+		s.jar = jar
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session] = jar
+}
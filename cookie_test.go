@@ -0,0 +1,103 @@
+package remilia
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	return u
+}
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		names[i] = cookie.Name
+	}
+	return names
+}
+
+func TestCookieJar(t *testing.T) {
+	t.Run("Domain", func(t *testing.T) {
+		jar := NewCookieJar()
+		jar.SetCookies(mustParseURL(t, "http://www.example.com/"), []*http.Cookie{
+			{Name: "host"},
+			{Name: "domain", Domain: ".example.com"},
+			{Name: "foreign", Domain: "other.com"},
+		})
+
+		assert.Equal(t, []string{"host", "domain"}, cookieNames(jar.Cookies(mustParseURL(t, "http://www.example.com/"))), "Both cookies should be sent to the host")
+		assert.Equal(t, []string{"domain"}, cookieNames(jar.Cookies(mustParseURL(t, "http://api.example.com/"))), "Only the domain cookie should be sent to a subdomain")
+		assert.Empty(t, jar.Cookies(mustParseURL(t, "http://other.com/")), "A cookie for a foreign domain should be rejected")
+	})
+
+	t.Run("Path", func(t *testing.T) {
+		jar := NewCookieJar()
+		jar.SetCookies(mustParseURL(t, "http://example.com/docs/page"), []*http.Cookie{
+			{Name: "default"},
+			{Name: "root", Path: "/"},
+			{Name: "deep", Path: "/docs/api"},
+		})
+
+		assert.Equal(t, []string{"deep", "default", "root"}, cookieNames(jar.Cookies(mustParseURL(t, "http://example.com/docs/api/v1"))), "Longer paths should come first")
+		assert.Equal(t, []string{"root"}, cookieNames(jar.Cookies(mustParseURL(t, "http://example.com/docsx"))), "Paths should match on segment boundaries")
+	})
+
+	t.Run("Secure", func(t *testing.T) {
+		jar := NewCookieJar()
+		jar.SetCookies(mustParseURL(t, "https://example.com/"), []*http.Cookie{{Name: "secure", Secure: true}})
+
+		assert.Len(t, jar.Cookies(mustParseURL(t, "https://example.com/")), 1, "A secure cookie should be sent over https")
+		assert.Empty(t, jar.Cookies(mustParseURL(t, "http://example.com/")), "A secure cookie should not be sent over http")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		jar := NewCookieJar()
+		jar.now = func() time.Time { return now }
+
+		u := mustParseURL(t, "http://example.com/")
+		jar.SetCookies(u, []*http.Cookie{
+			{Name: "session"},
+			{Name: "short", MaxAge: 10},
+			{Name: "expires", Expires: now.Add(time.Hour)},
+		})
+		assert.Len(t, jar.Cookies(u), 3, "Every cookie should be stored")
+
+		now = now.Add(time.Minute)
+		assert.Equal(t, []string{"session", "expires"}, cookieNames(jar.Cookies(u)), "An expired cookie should not be sent")
+
+		jar.SetCookies(u, []*http.Cookie{{Name: "session", MaxAge: -1}})
+		assert.Equal(t, []string{"expires"}, cookieNames(jar.Cookies(u)), "A negative Max-Age should delete the cookie")
+	})
+
+	t.Run("Export and import", func(t *testing.T) {
+		jar := NewCookieJar()
+		jar.SetCookies(mustParseURL(t, "https://example.com/"), []*http.Cookie{
+			{Name: "id", Value: "1", Domain: "example.com", Secure: true, HttpOnly: true, Expires: time.Unix(4102444800, 0)},
+			{Name: "theme", Value: "dark"},
+		})
+
+		var buf strings.Builder
+		assert.NoError(t, jar.Export(&buf), "Export should not return error")
+		assert.Equal(t, "# Netscape HTTP Cookie File\n"+
+			"#HttpOnly_.example.com\tTRUE\t/\tTRUE\t4102444800\tid\t1\n"+
+			"example.com\tFALSE\t/\tFALSE\t0\ttheme\tdark\n", buf.String(), "Cookies should be written in the Netscape format")
+
+		imported := NewCookieJar()
+		assert.NoError(t, imported.Import(strings.NewReader(buf.String())), "Import should not return error")
+		assert.Equal(t, []string{"id"}, cookieNames(imported.Cookies(mustParseURL(t, "https://www.example.com/"))), "Imported domain cookies should match subdomains")
+		assert.Len(t, imported.Cookies(mustParseURL(t, "https://example.com/")), 2, "Every cookie should be imported")
+
+		err := imported.Import(strings.NewReader("example.com\tFALSE\t/\n"))
+		assert.ErrorIs(t, err, errInvalidCookieLine, "A malformed line should be rejected")
+	})
+}
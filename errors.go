@@ -5,3 +5,12 @@ import "errors"
 var errInvalidInputBufferSize = errors.New("invalid input buffer size")
 var errInvalidConcurrency = errors.New("invalid concurrency")
 var errInvalidTimeout = errors.New("invalid timeout")
+var errInvalidBaseURL = errors.New("invalid base url")
+var errInvalidRetryPolicy = errors.New("invalid retry policy")
+var errInvalidMaxAttempts = errors.New("invalid max attempts")
+var errInvalidJitterStrategy = errors.New("invalid jitter strategy")
+var errInvalidMaxConns = errors.New("invalid max conns")
+var errInvalidLocalAddr = errors.New("invalid local address")
+var errNoFrontier = errors.New("no frontier configured")
+var errLoginFailed = errors.New("login failed")
+var errSessionExpired = errors.New("session expired after login")
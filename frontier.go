@@ -0,0 +1,296 @@
+package remilia
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Frontier durably records the requests of a crawl, so that a crawl which died
+// halfway through can be resumed with Remilia.Resume. Implementations must be
+// safe for concurrent use. Requests are identified by Request.Key, so that
+// requests to the same URL with different methods or bodies are kept apart.
+type Frontier interface {
+	// Push records a request which has been scheduled but not completed yet.
+	Push(req *Request) error
+	// Done records that a previously pushed request has been completed.
+	Done(req *Request) error
+	// Pending returns the requests which were pushed but never completed.
+	Pending() ([]*Request, error)
+	// Visited returns the keys of every request which was ever pushed.
+	Visited() ([]string, error)
+	// Close flushes and releases the underlying storage.
+	Close() error
+}
+
+const (
+	frontierOpPush = "push"
+	frontierOpDone = "done"
+)
+
+// frontierRecord is a single line of the append-only log of a file frontier.
+type frontierRecord struct {
+	Op        string `json:"op"`
+	Key       string `json:"key,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Headers   string `json:"headers,omitempty"`
+	Body      []byte `json:"body,omitempty"`
+	Depth     uint   `json:"depth,omitempty"`
+	ParentURL string `json:"parent,omitempty"`
+	Session   string `json:"session,omitempty"`
+
+	Query       string    `json:"query,omitempty"`
+	Timeouts    *Timeouts `json:"timeouts,omitempty"`
+	MaxAttempts uint8     `json:"attempts,omitempty"`
+	Proxy       string    `json:"proxy,omitempty"`
+}
+
+func newFrontierRecord(op string, req *Request) frontierRecord {
+	record := frontierRecord{
+		Op:  op,
+		Key: req.Key(),
+	}
+	if op == frontierOpDone {
+		return record
+	}
+
+	record.URL = string(req.URL)
+	record.Method = string(req.Method)
+	record.Body = req.Body
+	record.Depth = req.Depth
+	record.ParentURL = string(req.ParentURL)
+	record.Session = req.Session
+	record.MaxAttempts = req.MaxAttempts
+	record.Proxy = req.Proxy
+	if req.Headers != nil {
+		record.Headers = req.Headers.String()
+	}
+	if req.QueryParams != nil {
+		record.Query = req.QueryParams.String()
+	}
+	if req.Timeouts != (Timeouts{}) {
+		timeouts := req.Timeouts
+		record.Timeouts = &timeouts
+	}
+
+	return record
+}
+
+// key returns the key of the request of the record. Logs written before
+// records had keys are keyed by URL.
+func (fr frontierRecord) key() string {
+	if fr.Key != "" {
+		return fr.Key
+	}
+	return fr.URL
+}
+
+func (fr frontierRecord) request() (*Request, error) {
+	req, err := newRequest(withURL(fr.URL), withBody(fr.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Method = append(req.Method[:0], fr.Method...)
+	req.Headers.Parse(fr.Headers)
+	req.Depth = fr.Depth
+	req.ParentURL = append(req.ParentURL[:0], fr.ParentURL...)
+	req.Session = fr.Session
+	req.QueryParams.Parse(fr.Query)
+	if fr.Timeouts != nil {
+		req.Timeouts = *fr.Timeouts
+	}
+	req.MaxAttempts = fr.MaxAttempts
+	req.Proxy = fr.Proxy
+	req.key = fr.Key
+
+	return req, nil
+}
+
+// fileFrontier keeps the frontier in an append-only JSON Lines log. Every push
+// and completion is appended as one record, and the log is compacted to the
+// current state whenever it is opened.
+type fileFrontier struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+
+	pending map[string]frontierRecord
+	order   []string
+	visited map[string]struct{}
+}
+
+// NewFileFrontier opens the frontier log at path, creating it when it does not exist.
+// An existing log is replayed, so its pending and visited requests are kept.
+func NewFileFrontier(path string) (Frontier, error) {
+	f := &fileFrontier{
+		path:    path,
+		pending: make(map[string]frontierRecord),
+		visited: make(map[string]struct{}),
+	}
+
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *fileFrontier) replay() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record frontierRecord
+		// A crash while appending leaves a truncated last line, which is skipped.
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		f.apply(record)
+	}
+
+	return scanner.Err()
+}
+
+func (f *fileFrontier) apply(record frontierRecord) {
+	key := record.key()
+	switch record.Op {
+	case frontierOpPush:
+		if _, ok := f.visited[key]; !ok {
+			f.order = append(f.order, key)
+		}
+		f.visited[key] = struct{}{}
+		f.pending[key] = record
+	case frontierOpDone:
+		if _, ok := f.visited[key]; !ok {
+			f.order = append(f.order, key)
+		}
+		f.visited[key] = struct{}{}
+		delete(f.pending, key)
+	}
+}
+
+// compact rewrites the log with one record per visited request and reopens it for appending.
+func (f *fileFrontier) compact() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, key := range f.order {
+		record, ok := f.pending[key]
+		if !ok {
+			record = frontierRecord{Op: frontierOpDone, Key: key}
+		}
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return err
+	}
+
+	f.file, err = os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+func (f *fileFrontier) append(record frontierRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Each record is written with a single call, so a crash never interleaves two records
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	f.apply(record)
+
+	return nil
+}
+
+func (f *fileFrontier) Push(req *Request) error {
+	return f.append(newFrontierRecord(frontierOpPush, req))
+}
+
+func (f *fileFrontier) Done(req *Request) error {
+	return f.append(newFrontierRecord(frontierOpDone, req))
+}
+
+func (f *fileFrontier) Pending() ([]*Request, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	requests := make([]*Request, 0, len(f.pending))
+	for _, key := range f.order {
+		record, ok := f.pending[key]
+		if !ok {
+			continue
+		}
+
+		req, err := record.request()
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+func (f *fileFrontier) Visited() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, len(f.order))
+	copy(keys, f.order)
+
+	return keys, nil
+}
+
+func (f *fileFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
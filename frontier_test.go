@@ -0,0 +1,121 @@
+package remilia
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFrontier(t *testing.T) {
+	newTestRequest := func(url string, depth uint) *Request {
+		req, _ := newRequest(withURL(url), withMethod("POST"), withHeader("X-Test", "remilia"), withBody([]byte("body")))
+		req.Depth = depth
+		req.ParentURL = []byte("http://example.com/")
+		return req
+	}
+
+	t.Run("Track pending and visited requests", func(t *testing.T) {
+		f, err := NewFileFrontier(filepath.Join(t.TempDir(), "frontier.log"))
+		assert.NoError(t, err, "NewFileFrontier should not return error")
+		defer f.Close()
+
+		assert.NoError(t, f.Push(newTestRequest("http://example.com/a", 1)))
+		assert.NoError(t, f.Push(newTestRequest("http://example.com/b", 1)))
+		assert.NoError(t, f.Done(newTestRequest("http://example.com/a", 1)))
+
+		pending, err := f.Pending()
+		assert.NoError(t, err, "Pending should not return error")
+		assert.Len(t, pending, 1, "Only the uncompleted request should be pending")
+		assert.Equal(t, []byte("http://example.com/b"), pending[0].URL)
+
+		visited, err := f.Visited()
+		assert.NoError(t, err, "Visited should not return error")
+		assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, visited)
+	})
+
+	t.Run("Reload state after reopening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nested", "frontier.log")
+		f, err := NewFileFrontier(path)
+		assert.NoError(t, err, "NewFileFrontier should not return error")
+
+		f.Push(newTestRequest("http://example.com/a", 0))
+		f.Push(newTestRequest("http://example.com/b", 2))
+		f.Done(newTestRequest("http://example.com/a", 0))
+		assert.NoError(t, f.Close(), "Close should not return error")
+
+		reopened, err := NewFileFrontier(path)
+		assert.NoError(t, err, "NewFileFrontier should not return error")
+		defer reopened.Close()
+
+		pending, _ := reopened.Pending()
+		assert.Len(t, pending, 1, "Pending request should be restored")
+		req := pending[0]
+		assert.Equal(t, []byte("http://example.com/b"), req.URL, "URL should be restored")
+		assert.Equal(t, []byte("POST"), req.Method, "Method should be restored")
+		assert.Equal(t, []byte("remilia"), req.Headers.Peek("X-Test"), "Headers should be restored")
+		assert.Equal(t, []byte("body"), req.Body, "Body should be restored")
+		assert.Equal(t, uint(2), req.Depth, "Depth should be restored")
+		assert.Equal(t, []byte("http://example.com/"), req.ParentURL, "ParentURL should be restored")
+
+		visited, _ := reopened.Visited()
+		assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, visited, "Visited urls should be restored")
+	})
+
+	t.Run("Compact log when reopening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.log")
+		f, _ := NewFileFrontier(path)
+		for i := 0; i < 3; i++ {
+			f.Push(newTestRequest("http://example.com/a", 0))
+			f.Done(newTestRequest("http://example.com/a", 0))
+		}
+		f.Close()
+
+		reopened, _ := NewFileFrontier(path)
+		defer reopened.Close()
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "{\"op\":\"done\",\"key\":\"http://example.com/a\"}\n", string(content), "Log should only keep the current state")
+	})
+
+	t.Run("Keep requests to the same URL apart by key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.log")
+		f, _ := NewFileFrontier(path)
+
+		first, _ := NewRequest("POST", "http://example.com/search", WithRequestBody([]byte("q=a"), "text/plain"))
+		second, _ := NewRequest("POST", "http://example.com/search", WithRequestBody([]byte("q=b"), "text/plain"))
+		first.key = requestKey(first, "http://example.com/search")
+		second.key = requestKey(second, "http://example.com/search")
+		f.Push(first)
+		f.Push(second)
+		f.Close()
+
+		reopened, _ := NewFileFrontier(path)
+		defer reopened.Close()
+
+		pending, _ := reopened.Pending()
+		assert.Len(t, pending, 2, "Both requests should be pending")
+		assert.Equal(t, []byte("q=a"), pending[0].Body, "First body should be restored")
+		assert.Equal(t, []byte("q=b"), pending[1].Body, "Second body should be restored")
+		assert.Equal(t, first.Key(), pending[0].Key(), "Key should be restored")
+
+		reopened.Done(pending[0])
+		remaining, _ := reopened.Pending()
+		assert.Len(t, remaining, 1, "Only the completed request should be done")
+		assert.Equal(t, []byte("q=b"), remaining[0].Body, "The other request should stay pending")
+	})
+
+	t.Run("Skip truncated last record", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.log")
+		content := "{\"op\":\"push\",\"url\":\"http://example.com/a\"}\n{\"op\":\"done\",\"url\":\"http://exa"
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+		f, err := NewFileFrontier(path)
+		assert.NoError(t, err, "NewFileFrontier should not return error")
+		defer f.Close()
+
+		pending, _ := f.Pending()
+		assert.Len(t, pending, 1, "Truncated done record should be ignored")
+	})
+}
@@ -0,0 +1,203 @@
+package remilia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Item is a piece of structured data scraped from a document, usually a map
+// or a user defined struct.
+type Item any
+
+// ErrDropItem is returned by an ItemStage to drop an item without logging it as a failure.
+var ErrDropItem = errors.New("drop item")
+
+// ItemStage processes one item and returns the item handed to the next stage.
+type ItemStage func(item Item) (Item, error)
+
+// ValidateItem drops the items for which fn returns an error. The error wraps
+// both ErrDropItem and the error of fn.
+func ValidateItem(fn func(item Item) error) ItemStage {
+	return func(item Item) (Item, error) {
+		if err := fn(item); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDropItem, err)
+		}
+		return item, nil
+	}
+}
+
+// TransformItem replaces every item with the result of fn.
+func TransformItem(fn func(item Item) (Item, error)) ItemStage {
+	return ItemStage(fn)
+}
+
+// DedupeItem drops the items whose key was already seen.
+func DedupeItem(key func(item Item) string) ItemStage {
+	var mu sync.Mutex
+	seen := make(map[string]struct{})
+
+	return func(item Item) (Item, error) {
+		k := key(item)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := seen[k]; ok {
+			return nil, ErrDropItem
+		}
+		seen[k] = struct{}{}
+
+		return item, nil
+	}
+}
+
+// SinkItem hands every item to fn and passes it on unchanged.
+func SinkItem(fn func(item Item) error) ItemStage {
+	return func(item Item) (Item, error) {
+		if err := fn(item); err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+type itemOptions struct {
+	stages    []ItemStage
+	workers   uint
+	sinks     []ItemSink
+	batchSize uint
+}
+
+func (o *itemOptions) enabled() bool {
+	return o != nil && (len(o.stages) > 0 || len(o.sinks) > 0)
+}
+
+// itemPipeline runs the item stages concurrently with the crawl.
+type itemPipeline struct {
+	opts   *itemOptions
+	logger Logger
+	stats  *crawlStats
+
+	stages []ItemStage
+	sinks  []*batchingSink
+
+	items chan Item
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func newItemPipeline(opts *itemOptions, logger Logger, stats *crawlStats) *itemPipeline {
+	ip := &itemPipeline{
+		opts:   opts,
+		logger: logger,
+		stats:  stats,
+		stages: append([]ItemStage(nil), opts.stages...),
+		items:  make(chan Item, 100),
+	}
+
+	// Sinks run after the user stages, so they only see the items which made it through
+	for _, sink := range opts.sinks {
+		bs := newBatchingSink(sink, opts.batchSize)
+		ip.sinks = append(ip.sinks, bs)
+		ip.stages = append(ip.stages, bs.stage())
+	}
+
+	return ip
+}
+
+func (ip *itemPipeline) start() {
+	for i := uint(0); i < ip.opts.workers; i++ {
+		ip.wg.Add(1)
+		go func() {
+			defer ip.wg.Done()
+			for item := range ip.items {
+				ip.process(item)
+			}
+		}()
+	}
+}
+
+func (ip *itemPipeline) process(item Item) {
+	var err error
+	for _, stage := range ip.stages {
+		item, err = stage(item)
+		var sinkErr *SinkError
+		if errors.As(err, &sinkErr) {
+			// The item is in the lost batch, the stages after the sink still get it
+			ip.sinkFailed(sinkErr)
+			continue
+		}
+		if errors.Is(err, ErrDropItem) {
+			ip.stats.itemsDropped.Add(1)
+			ip.logger.Debug("Dropped item", logContext{
+				"reason": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			ip.stats.itemsFailed.Add(1)
+			ip.logger.Warn("Failed to process item", logContext{
+				"err": err,
+			})
+			return
+		}
+	}
+
+	ip.stats.itemsProcessed.Add(1)
+}
+
+// sinkFailed records the items a sink failed to write, which wait reports.
+func (ip *itemPipeline) sinkFailed(err *SinkError) {
+	ip.stats.itemsLost.Add(uint64(len(err.Items)))
+	ip.logger.Error("Failed to write items", logContext{
+		"err":   err.Err,
+		"items": len(err.Items),
+	})
+
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.errs = append(ip.errs, err)
+}
+
+// emitter returns a Put which hands items to the pipeline until ctx is done.
+func (ip *itemPipeline) emitter(ctx context.Context) Put[Item] {
+	return func(item Item) {
+		select {
+		case ip.items <- item:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// wait stops accepting items, blocks until every emitted item was processed
+// and flushes the sinks. The returned error holds a *SinkError for every batch
+// a sink failed to write during the crawl.
+func (ip *itemPipeline) wait() error {
+	close(ip.items)
+	ip.wg.Wait()
+
+	for _, sink := range ip.sinks {
+		err := sink.flush()
+		var sinkErr *SinkError
+		if errors.As(err, &sinkErr) {
+			ip.sinkFailed(sinkErr)
+		} else if err != nil {
+			ip.errs = append(ip.errs, err)
+		}
+	}
+	return errors.Join(ip.errs...)
+}
+
+type itemEmitterKey struct{}
+
+// itemEmitter returns the Put layers use to emit items during the crawl running with ctx.
+func itemEmitter(ctx context.Context) Put[Item] {
+	if emit, ok := ctx.Value(itemEmitterKey{}).(Put[Item]); ok {
+		return emit
+	}
+	return func(Item) {}
+}
@@ -0,0 +1,137 @@
+package remilia
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestItemStages(t *testing.T) {
+	t.Run("ValidateItem", func(t *testing.T) {
+		stage := ValidateItem(func(item Item) error {
+			if item.(int) < 0 {
+				return errors.New("negative")
+			}
+			return nil
+		})
+
+		item, err := stage(1)
+		assert.NoError(t, err, "ValidateItem should accept valid item")
+		assert.Equal(t, 1, item, "ValidateItem should pass the item on")
+
+		_, err = stage(-1)
+		assert.ErrorIs(t, err, ErrDropItem, "ValidateItem should drop invalid item")
+		assert.EqualError(t, err, "drop item: negative", "ValidateItem should keep the reason")
+	})
+
+	t.Run("TransformItem", func(t *testing.T) {
+		stage := TransformItem(func(item Item) (Item, error) {
+			return item.(int) * 2, nil
+		})
+
+		item, err := stage(2)
+		assert.NoError(t, err, "TransformItem should not return error")
+		assert.Equal(t, 4, item, "TransformItem should replace the item")
+	})
+
+	t.Run("DedupeItem", func(t *testing.T) {
+		stage := DedupeItem(func(item Item) string {
+			return item.(map[string]string)["id"]
+		})
+
+		_, err := stage(map[string]string{"id": "1"})
+		assert.NoError(t, err, "DedupeItem should accept the first item")
+
+		_, err = stage(map[string]string{"id": "1", "other": "field"})
+		assert.Equal(t, ErrDropItem, err, "DedupeItem should drop the duplicated item")
+
+		_, err = stage(map[string]string{"id": "2"})
+		assert.NoError(t, err, "DedupeItem should accept another item")
+	})
+
+	t.Run("SinkItem", func(t *testing.T) {
+		var sunk []Item
+		stage := SinkItem(func(item Item) error {
+			sunk = append(sunk, item)
+			return nil
+		})
+
+		item, err := stage("item")
+		assert.NoError(t, err, "SinkItem should not return error")
+		assert.Equal(t, "item", item, "SinkItem should pass the item on")
+		assert.Equal(t, []Item{"item"}, sunk, "SinkItem should hand the item to the sink")
+	})
+}
+
+func TestItemPipeline(t *testing.T) {
+	var mu sync.Mutex
+	var sunk []Item
+
+	stats := &crawlStats{}
+	ip := newItemPipeline(&itemOptions{
+		workers: 2,
+		stages: []ItemStage{
+			ValidateItem(func(item Item) error {
+				if item.(int) == 0 {
+					return errors.New("zero")
+				}
+				return nil
+			}),
+			DedupeItem(func(item Item) string {
+				return strings.Repeat("x", item.(int))
+			}),
+			TransformItem(func(item Item) (Item, error) {
+				if item.(int) == 4 {
+					return nil, errors.New("four")
+				}
+				return item, nil
+			}),
+			SinkItem(func(item Item) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sunk = append(sunk, item)
+				return nil
+			}),
+		},
+	}, &defaultLogger{internal: zap.NewNop()}, stats)
+
+	ip.start()
+	emit := ip.emitter(context.Background())
+	for _, item := range []int{1, 2, 2, 0, 3, 4} {
+		emit(item)
+	}
+	ip.wait()
+
+	assert.ElementsMatch(t, []Item{1, 2, 3}, sunk, "Only valid and unique items should reach the sink")
+	assert.Equal(t, uint64(3), stats.itemsProcessed.Load(), "Processed items should be counted")
+	assert.Equal(t, uint64(2), stats.itemsDropped.Load(), "Invalid and duplicated items should be counted as dropped")
+	assert.Equal(t, uint64(1), stats.itemsFailed.Load(), "Failed items should be counted")
+}
+
+func TestDoWithItems(t *testing.T) {
+	var sunk []Item
+	instance, _ := New(WithItemPipeline(SinkItem(func(item Item) error {
+		sunk = append(sunk, item)
+		return nil
+	})))
+	instance.client = &fakeHTTPClient{}
+
+	titles := func(in *goquery.Document, put Put[string], emit Put[Item]) {
+		in.Find("a").Each(func(i int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			emit(map[string]string{"href": href})
+		})
+	}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddItemLayer(titles))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.Equal(t, []Item{map[string]string{"href": "/a"}, map[string]string{"href": "/b"}}, sunk, "Do should wait for every emitted item")
+	assert.Equal(t, uint64(2), instance.Stats().ItemsProcessed, "Stats should count the processed items")
+}
@@ -1,15 +1,253 @@
 package remilia
 
-import "time"
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
 
+var errInvalidDelay = errors.New("invalid delay")
+
+// limit describes the rate limiting policy applied to every host under AllowedDomain.
 type limit struct {
 	AllowedDomain string
 	Delay         time.Duration
+
+	Capacity     int64
+	FillInterval time.Duration
+	FillQuantum  int64
 }
 
 func newLimit(domain string, delay time.Duration) *limit {
 	return &limit{
 		AllowedDomain: domain,
 		Delay:         delay,
+		Capacity:      defaultCapacity,
+		FillInterval:  defaultFillInterval,
+		FillQuantum:   defaultFillQuantum,
+	}
+}
+
+func (l *limit) newBucket(clock Clock) (*RateLimitation, error) {
+	return NewBucket(
+		withLimitationClock(clock),
+		withLimitationCapacity(l.Capacity),
+		withLimitationFillInterval(l.FillInterval),
+		withLimitationFillQuantum(l.FillQuantum),
+		withLimitationInitiallyAvailToken(l.Capacity),
+	)
+}
+
+type LimitOptionFunc optionFunc[*limit]
+
+// WithLimitCapacity sets the maximum number of tokens the bucket of a host can hold.
+func WithLimitCapacity(capacity int64) LimitOptionFunc {
+	return func(l *limit) error {
+		if capacity <= 0 {
+			return errInvalidCapacity
+		}
+		l.Capacity = capacity
+		return nil
+	}
+}
+
+// WithLimitFillInterval sets how often tokens are added to the bucket of a host.
+func WithLimitFillInterval(fillInterval time.Duration) LimitOptionFunc {
+	return func(l *limit) error {
+		if fillInterval <= 0 {
+			return errInvalidFillInterval
+		}
+		l.FillInterval = fillInterval
+		return nil
+	}
+}
+
+// WithLimitFillQuantum sets how many tokens are added to the bucket of a host per interval.
+func WithLimitFillQuantum(fillQuantum int64) LimitOptionFunc {
+	return func(l *limit) error {
+		if fillQuantum <= 0 {
+			return errInvalidFillQuantum
+		}
+		l.FillQuantum = fillQuantum
+		return nil
+	}
+}
+
+// WithLimitDelay sets the minimum delay between the start of two requests to the same host.
+func WithLimitDelay(delay time.Duration) LimitOptionFunc {
+	return func(l *limit) error {
+		if delay < 0 {
+			return errInvalidDelay
+		}
+		l.Delay = delay
+		return nil
+	}
+}
+
+// hostBucket is the limiter state of a single host.
+type hostBucket struct {
+	bucket *RateLimitation
+	delay  time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// reserve returns how long the caller has to wait before it may send a request.
+func (hb *hostBucket) reserve(now time.Time) time.Duration {
+	start := now.Add(hb.bucket.Take(1))
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	if start.Before(hb.next) {
+		start = hb.next
+	}
+	hb.next = start.Add(hb.delay)
+
+	return start.Sub(now)
+}
+
+// hostLimiter keeps a token bucket per request host, so that a slow policy
+// on one site does not throttle requests to the others.
+type hostLimiter struct {
+	clock    Clock
+	defaults *limit
+
+	mu      sync.Mutex
+	domains map[string]*limit
+	hosts   map[string]*hostBucket
+}
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{
+		clock:    defaultClock,
+		defaults: newLimit("", 0),
+		domains:  make(map[string]*limit),
+		hosts:    make(map[string]*hostBucket),
+	}
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimPrefix(strings.ToLower(host), ".")
+}
+
+// setDomain registers l for its domain and drops the buckets of matching hosts,
+// so that they are rebuilt with the new parameters.
+func (hl *hostLimiter) setDomain(l *limit) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	domain := normalizeHost(l.AllowedDomain)
+	hl.domains[domain] = l
+	for host := range hl.hosts {
+		if hostMatchesDomain(host, domain) {
+			delete(hl.hosts, host)
+		}
+	}
+}
+
+func (hl *hostLimiter) setDefaults(l *limit) {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	hl.defaults = l
+	hl.hosts = make(map[string]*hostBucket)
+}
+
+func hostMatchesDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// lookup returns the most specific limit registered for host.
+func (hl *hostLimiter) lookup(host string) *limit {
+	for domain := host; domain != ""; {
+		if l, ok := hl.domains[domain]; ok {
+			return l
+		}
+
+		idx := strings.IndexByte(domain, '.')
+		if idx < 0 {
+			break
+		}
+		domain = domain[idx+1:]
+	}
+
+	return hl.defaults
+}
+
+func (hl *hostLimiter) bucketFor(host string) (*hostBucket, error) {
+	host = normalizeHost(host)
+
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	if hb, ok := hl.hosts[host]; ok {
+		return hb, nil
+	}
+
+	l := hl.lookup(host)
+	bucket, err := l.newBucket(hl.clock)
+	if err != nil {
+		return nil, err
+	}
+
+	hb := &hostBucket{
+		bucket: bucket,
+		delay:  l.Delay,
+	}
+	hl.hosts[host] = hb
+
+	return hb, nil
+}
+
+// setHostDelay raises the minimum delay between requests to host to at least delay.
+func (hl *hostLimiter) setHostDelay(host string, delay time.Duration) {
+	hb, err := hl.bucketFor(host)
+	if err != nil {
+		return
+	}
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	if delay > hb.delay {
+		hb.delay = delay
+	}
+}
+
+// Wait blocks until a request to host is allowed, or returns ctx.Err() once ctx is done.
+func (hl *hostLimiter) Wait(ctx context.Context, host string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	hb, err := hl.bucketFor(host)
+	if err != nil {
+		return err
+	}
+
+	wait := hb.reserve(hl.clock.Now())
+	if wait > 0 {
+		return sleepContext(ctx, hl.clock, wait)
+	}
+
+	return nil
+}
+
+// WrapContext returns an ExecutableFunc which waits for the limiter of host before calling op.
+func (hl *hostLimiter) WrapContext(ctx context.Context, host string, op func() error) ExecutableFunc {
+	return func() error {
+		if err := hl.Wait(ctx, host); err != nil {
+			return err
+		}
+		return op()
 	}
 }
@@ -0,0 +1,167 @@
+package remilia
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitOptions(t *testing.T) {
+	t.Run("Successfully build with default value", func(t *testing.T) {
+		l := newLimit("example.com", time.Second)
+
+		assert.Equal(t, "example.com", l.AllowedDomain, "AllowedDomain should be set")
+		assert.Equal(t, time.Second, l.Delay, "Delay should be set")
+		assert.Equal(t, defaultCapacity, l.Capacity, "Capacity should be the default capacity")
+		assert.Equal(t, defaultFillInterval, l.FillInterval, "FillInterval should be the default fill interval")
+		assert.Equal(t, defaultFillQuantum, l.FillQuantum, "FillQuantum should be the default fill quantum")
+	})
+
+	t.Run("Successfully build with valid options", func(t *testing.T) {
+		l, err := buildLimit("example.com", []LimitOptionFunc{
+			WithLimitCapacity(5),
+			WithLimitFillInterval(time.Minute),
+			WithLimitFillQuantum(2),
+			WithLimitDelay(time.Second),
+		})
+
+		assert.NoError(t, err, "buildLimit should not return error")
+		assert.Equal(t, int64(5), l.Capacity, "Capacity should be 5")
+		assert.Equal(t, time.Minute, l.FillInterval, "FillInterval should be 1 minute")
+		assert.Equal(t, int64(2), l.FillQuantum, "FillQuantum should be 2")
+		assert.Equal(t, time.Second, l.Delay, "Delay should be 1 second")
+	})
+
+	t.Run("Failed build with invalid options", func(t *testing.T) {
+		tests := []struct {
+			name string
+			opt  LimitOptionFunc
+			err  error
+		}{
+			{"Invalid capacity", WithLimitCapacity(0), errInvalidCapacity},
+			{"Invalid fill interval", WithLimitFillInterval(0), errInvalidFillInterval},
+			{"Invalid fill quantum", WithLimitFillQuantum(0), errInvalidFillQuantum},
+			{"Invalid delay", WithLimitDelay(-1), errInvalidDelay},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				l, err := buildLimit("example.com", []LimitOptionFunc{tc.opt})
+
+				assert.Nil(t, l, "limit should be nil")
+				assert.Equal(t, tc.err, err, "buildLimit should return the option error")
+			})
+		}
+	})
+}
+
+func TestHostLimiter(t *testing.T) {
+	t.Run("Each host gets its own bucket", func(t *testing.T) {
+		hl := newHostLimiter()
+
+		a, _ := hl.bucketFor("a.com")
+		b, _ := hl.bucketFor("b.com")
+		again, _ := hl.bucketFor("A.com:443")
+
+		assert.NotSame(t, a, b, "Different hosts should not share a bucket")
+		assert.Same(t, a, again, "The same host should reuse its bucket")
+	})
+
+	t.Run("Most specific domain limit wins", func(t *testing.T) {
+		hl := newHostLimiter()
+		parent, _ := buildLimit("example.com", []LimitOptionFunc{WithLimitDelay(time.Second)})
+		child, _ := buildLimit("api.example.com", []LimitOptionFunc{WithLimitDelay(time.Minute)})
+		hl.setDomain(parent)
+		hl.setDomain(child)
+
+		assert.Same(t, parent, hl.lookup("www.example.com"), "Subdomain should use the parent domain limit")
+		assert.Same(t, parent, hl.lookup("example.com"), "Domain should use its own limit")
+		assert.Same(t, child, hl.lookup("v1.api.example.com"), "Nested subdomain should use the most specific limit")
+		assert.Same(t, hl.defaults, hl.lookup("other.com"), "Unknown host should use the default limit")
+	})
+
+	t.Run("Minimum delay is applied between requests to the same host", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+
+		hl := newHostLimiter()
+		hl.clock = mockClock
+		l, _ := buildLimit("example.com", []LimitOptionFunc{WithLimitDelay(time.Second)})
+		hl.setDomain(l)
+
+		slow, _ := hl.bucketFor("example.com")
+		fast, _ := hl.bucketFor("other.com")
+
+		assert.Equal(t, time.Duration(0), slow.reserve(time.Unix(0, 0)), "First request should not wait")
+		assert.Equal(t, time.Second, slow.reserve(time.Unix(0, 0)), "Second request should wait for the delay")
+		assert.Equal(t, 2*time.Second, slow.reserve(time.Unix(0, 0)), "Third request should queue behind the second")
+		assert.Equal(t, time.Duration(0), fast.reserve(time.Unix(0, 0)), "Other hosts should not be throttled")
+	})
+
+	t.Run("Back-to-back requests to a host wait for the fill interval", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+
+		hl := newHostLimiter()
+		hl.clock = mockClock
+		l, _ := buildLimit("example.com", []LimitOptionFunc{WithLimitCapacity(1), WithLimitFillInterval(time.Second)})
+		hl.setDomain(l)
+
+		hb, _ := hl.bucketFor("example.com")
+		assert.Equal(t, time.Duration(0), hb.reserve(time.Unix(0, 0)), "First request should not wait")
+		for i := 1; i < 5; i++ {
+			assert.GreaterOrEqual(t, hb.reserve(time.Unix(0, 0)), time.Second, "Request %d should wait at least the fill interval", i)
+		}
+	})
+
+	t.Run("Wait sleeps on the configured clock", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+		mockClock.On("Sleep", time.Second).Return().Once()
+
+		hl := newHostLimiter()
+		hl.clock = mockClock
+		l, _ := buildLimit("example.com", []LimitOptionFunc{WithLimitDelay(time.Second)})
+		hl.setDomain(l)
+
+		assert.NoError(t, hl.Wait(context.Background(), "example.com"), "First wait should not return error")
+		assert.NoError(t, hl.Wait(context.Background(), "example.com"), "Second wait should not return error")
+		mockClock.AssertExpectations(t)
+	})
+
+	t.Run("Wait returns context error when cancelled", func(t *testing.T) {
+		hl := newHostLimiter()
+		l, _ := buildLimit("example.com", []LimitOptionFunc{WithLimitDelay(time.Hour)})
+		hl.setDomain(l)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.NoError(t, hl.Wait(ctx, "example.com"), "First wait should not return error")
+		assert.ErrorIs(t, hl.Wait(ctx, "example.com"), context.DeadlineExceeded, "Second wait should be interrupted")
+	})
+
+	t.Run("Client options configure the registry", func(t *testing.T) {
+		client, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			WithDefaultLimit(WithLimitCapacity(1)),
+			WithDomainLimit("example.com", WithLimitDelay(time.Second)),
+		)
+
+		assert.NoError(t, err, "newClient should not return error")
+		assert.Equal(t, int64(1), client.hostLimiter.defaults.Capacity, "Default limit should be set")
+		assert.Equal(t, time.Second, client.hostLimiter.lookup("www.example.com").Delay, "Domain limit should be set")
+	})
+
+	t.Run("Client options return invalid limit error", func(t *testing.T) {
+		client, err := newClient(
+			withInternalClient(new(mockInternalClient)),
+			WithDomainLimit("example.com", WithLimitDelay(-1)),
+		)
+
+		assert.Nil(t, client, "Client should be nil")
+		assert.Equal(t, errInvalidDelay, err, "newClient should return the limit error")
+	})
+}
@@ -0,0 +1,199 @@
+package remilia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// netHTTPTransport sends requests with net/http, which speaks HTTP/2 with the
+// servers supporting it. Requests and responses are converted from and to
+// fasthttp, so that the client behaves the same with either transport. Like
+// with fasthttp, redirects are left to the client and bodies are not decompressed.
+type netHTTPTransport struct {
+	mu         sync.Mutex
+	config     transportConfig
+	dialer     *fasthttp.TCPDialer
+	transports map[transportKey]*http.Transport
+}
+
+func newNetHTTPTransport() *netHTTPTransport {
+	t := &netHTTPTransport{}
+	t.configure(transportConfig{})
+	return t
+}
+
+func (t *netHTTPTransport) configure(config transportConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+
+	t.config = config
+	t.dialer = &fasthttp.TCPDialer{
+		Concurrency:      defaultDialConcurrency,
+		LocalAddr:        config.localAddr,
+		Resolver:         config.resolver,
+		DNSCacheDuration: config.dnsCacheTTL,
+	}
+	t.transports = make(map[transportKey]*http.Transport)
+}
+
+func (t *netHTTPTransport) transportFor(timeouts Timeouts, proxy *url.URL) *http.Transport {
+	// The total timeout is enforced per request, so it doesn't need a transport of its own
+	timeouts.Total = 0
+	key := transportKey{timeouts: timeouts}
+	if proxy != nil {
+		key.proxy = proxy.String()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	transport, ok := t.transports[key]
+	if ok {
+		return transport
+	}
+
+	// The dialer of fasthttp is reused, so that DNS caching, custom resolvers
+	// and local addresses work the same with both transports
+	dialer := t.dialer
+	dial := func(addr string) (net.Conn, error) {
+		if timeouts.Connect > 0 {
+			return dialer.DialTimeout(addr, timeouts.Connect)
+		}
+		return dialer.Dial(addr)
+	}
+	if proxy != nil {
+		dial = proxyDialer(proxy, dial, timeouts.Connect)
+	}
+
+	idleTimeout := t.config.idleConnTimeout
+	if idleTimeout == 0 {
+		idleTimeout = fasthttp.DefaultMaxIdleConnDuration
+	}
+
+	transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(addr)
+		},
+		TLSClientConfig:       t.config.tlsConfig.Clone(),
+		TLSHandshakeTimeout:   timeouts.TLSHandshake,
+		ResponseHeaderTimeout: timeouts.FirstByte,
+		DisableCompression:    true,
+		ForceAttemptHTTP2:     true,
+		MaxConnsPerHost:       t.config.maxConnsPerHost,
+		MaxIdleConns:          t.config.maxIdleConns,
+		MaxIdleConnsPerHost:   t.config.maxConnsPerHost,
+		IdleConnTimeout:       idleTimeout,
+	}
+	t.transports[key] = transport
+
+	return transport
+}
+
+func (t *netHTTPTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return t.DoProxy(req, resp, Timeouts{}, nil)
+}
+
+func (t *netHTTPTransport) DoTimeouts(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts) error {
+	return t.DoProxy(req, resp, timeouts, nil)
+}
+
+func (t *netHTTPTransport) DoProxy(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error {
+	return t.DoContext(context.Background(), req, resp, timeouts, proxy)
+}
+
+// DoContext is like DoProxy, but abandons the request in flight once ctx is
+// done and returns ctx.Err().
+func (t *netHTTPTransport) DoContext(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error {
+	reqCtx := ctx
+	if timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, timeouts.Total)
+		defer cancel()
+	}
+
+	httpReq, err := toHTTPRequest(reqCtx, req)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: t.transportFor(timeouts, proxy),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// fasthttp reports an exceeded total timeout as ErrTimeout, which is retried
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fasthttp.ErrTimeout
+		}
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	return copyHTTPResponse(resp, httpResp)
+}
+
+// toHTTPRequest converts req, which must stay alive until the request is sent.
+func toHTTPRequest(ctx context.Context, req *fasthttp.Request) (*http.Request, error) {
+	var body io.Reader
+	if len(req.Body()) > 0 {
+		body = bytes.NewReader(req.Body())
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, string(req.Header.Method()), req.URI().String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.VisitAll(func(key, value []byte) {
+		switch string(key) {
+		case fasthttp.HeaderHost:
+			httpReq.Host = string(value)
+		case fasthttp.HeaderContentLength:
+		default:
+			httpReq.Header.Add(string(key), string(value))
+		}
+	})
+	// fasthttp sends no User-Agent unless one is set
+	if httpReq.Header.Get(fasthttp.HeaderUserAgent) == "" {
+		httpReq.Header.Set(fasthttp.HeaderUserAgent, "")
+	}
+
+	return httpReq, nil
+}
+
+func copyHTTPResponse(resp *fasthttp.Response, httpResp *http.Response) error {
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Reset()
+	resp.SetStatusCode(httpResp.StatusCode)
+	for key, values := range httpResp.Header {
+		for _, value := range values {
+			resp.Header.Add(key, value)
+		}
+	}
+	resp.SetBody(body)
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package remilia
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+func newTransportTestClient(t *testing.T, opts ...ClientOptionFunc) *Client {
+	client, err := newClient(append([]ClientOptionFunc{
+		withInternalClient(newFastHTTPTransport()),
+		withDocumentCreator(&defaultDocumentCreator{}),
+		withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+		WithMaxAttempt(1),
+	}, opts...)...)
+	assert.NoError(t, err)
+	return client
+}
+
+func TestNetHTTPTransport(t *testing.T) {
+	t.Run("Requests and responses match the fasthttp transport", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("X-Echo", r.Method+" "+r.URL.RawQuery+" "+r.Header.Get("X-Test")+" "+r.UserAgent()+" "+string(body))
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1", Path: "/"})
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("<p>" + r.Header.Get("Cookie") + "</p>"))
+		}))
+		defer server.Close()
+
+		type result struct {
+			status   int
+			echo     string
+			setCook  string
+			text     string
+			location string
+			url      string
+		}
+		run := func(opts ...ClientOptionFunc) []result {
+			client := newTransportTestClient(t, opts...)
+			var results []result
+			for _, path := range []string{"/", "/", "/redirect"} {
+				request, err := NewRequest("POST", server.URL+path,
+					WithRequestHeader("X-Test", "remilia"),
+					WithRequestQueryParam("q", "1"),
+					WithRequestBody([]byte("payload"), "text/plain"),
+				)
+				assert.NoError(t, err)
+
+				response, err := client.execute(context.Background(), request)
+				assert.NoError(t, err)
+				results = append(results, result{
+					status:   response.StatusCode,
+					echo:     response.Header.Get("X-Echo"),
+					setCook:  response.Header.Get("Set-Cookie"),
+					text:     response.Document().Find("p").Text(),
+					location: response.Header.Get("Location"),
+					url:      response.URL,
+				})
+			}
+			return results
+		}
+
+		fast := run()
+		std := run(WithNetHTTPTransport())
+
+		assert.Equal(t, fast, std, "both transports should produce the same responses")
+		assert.Equal(t, "POST q=1 remilia  payload", std[0].echo, "the request should be sent as built")
+		assert.Equal(t, "sid=1", std[1].text, "cookies should be kept between requests")
+		assert.Equal(t, server.URL+"/", std[2].url, "redirects should be followed")
+		assert.Equal(t, "GET  remilia", std[2].echo, "a 302 should turn the request into a GET without a body")
+	})
+
+	t.Run("HTTP/2", func(t *testing.T) {
+		var proto int
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proto = r.ProtoMajor
+			w.Write([]byte("<p>h2</p>"))
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		client := newTransportTestClient(t, WithNetHTTPTransport(), WithInsecureSkipVerify())
+		request, _ := NewRequest("GET", server.URL)
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, proto, "the request should be sent with HTTP/2")
+		assert.Equal(t, "h2", response.Document().Find("p").Text(), "the response should be parsed")
+	})
+
+	t.Run("Total timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(server.URL)
+
+		err := newNetHTTPTransport().DoTimeouts(req, resp, Timeouts{Total: 50 * time.Millisecond})
+		assert.ErrorIs(t, err, fasthttp.ErrTimeout, "the timeout should be reported like fasthttp does")
+	})
+
+	t.Run("Cancel a request in flight", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		client := newTransportTestClient(t, WithNetHTTPTransport())
+		request, _ := NewRequest("GET", server.URL)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := client.execute(ctx, request)
+		assert.ErrorIs(t, err, context.Canceled, "the request should stop with the context")
+		assert.Less(t, time.Since(start), time.Second, "the request should not wait for the server")
+	})
+
+	t.Run("SOCKS5 proxy", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<p>proxied</p>"))
+		}))
+		defer server.Close()
+		proxy := newStandInProxy(t, socks5Handshake)
+
+		client := newTransportTestClient(t, WithNetHTTPTransport(), WithProxy("socks5://"+proxy.ln.Addr().String()))
+		request, _ := NewRequest("GET", server.URL)
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "proxied", response.Document().Find("p").Text(), "the response should come through the proxy")
+		assert.Equal(t, int32(1), proxy.tunnels.Load(), "the request should be tunneled")
+	})
+}
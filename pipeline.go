@@ -1,6 +1,7 @@
 package remilia
 
 import (
+	"context"
 	"sync"
 
 	"golang.org/x/sync/errgroup"
@@ -48,31 +49,38 @@ func newPipeline[T any](pd providerDef[T], stageDefs ...actionLayerDef[T]) (*pip
 	return p, nil
 }
 
-func (p *pipeline[T]) execute() error {
-	var eg errgroup.Group
+// execute runs every stage of the pipeline until all of them finish or ctx is done.
+// When ctx is cancelled, stages stop taking new work, the channels are drained and
+// ctx.Err() is returned.
+func (p *pipeline[T]) execute(ctx context.Context) error {
+	eg, egCtx := errgroup.WithContext(ctx)
 
 	// TODO: currently it's only horizontal concurrency, we need to support vertical to improve the
-	execute(&eg, p.provider)
+	execute(egCtx, eg, p.provider)
 	for _, stage := range p.layers {
-		execute(&eg, stage)
+		execute(egCtx, eg, stage)
 	}
 
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	return ctx.Err()
 }
 
 type executor interface {
-	execute() error
+	execute(ctx context.Context) error
 	outputChannelCloser() func()
 	exhaustInputChannel()
 	concurrency() uint
 }
 
-func execute(eg *errgroup.Group, executor executor) {
+func execute(ctx context.Context, eg *errgroup.Group, executor executor) {
 	outputChannelCloser := executor.outputChannelCloser()
 
 	for i := uint(0); i < executor.concurrency(); i++ {
 		eg.Go(func() error {
-			err := executor.execute()
+			err := executor.execute(ctx)
 			outputChannelCloser()
 			executor.exhaustInputChannel()
 
@@ -161,6 +169,33 @@ func (cs commonStage[T]) concurrency() uint {
 	return cs.opts.concurrency
 }
 
+// getter returns a Get which stops yielding values once ctx is done.
+func (cs commonStage[T]) getter(ctx context.Context) Get[T] {
+	return func() (out T, ok bool) {
+		select {
+		case out, ok = <-cs.inCh:
+			return out, ok
+		case <-ctx.Done():
+			return out, false
+		}
+	}
+}
+
+// putter returns a Put which discards values once ctx is done, so that
+// a cancelled stage never blocks on a downstream which stopped reading.
+func (cs commonStage[T]) putter(ctx context.Context) Put[T] {
+	return func(v T) {
+		if !cs.emitToOutCh {
+			return
+		}
+
+		select {
+		case cs.outCh <- v:
+		case <-ctx.Done():
+		}
+	}
+}
+
 type Put[T any] func(T)
 type Get[T any] func() (T, bool)
 
@@ -173,12 +208,11 @@ type providerDef[T any] func() (*provider[T], error)
 
 type provider[T any] struct {
 	commonStage[T]
-	fn     workFn[T]
-	getter func() (T, bool)
+	fn workFn[T]
 }
 
 func buildProvider[T any](fn workFn[T], opts *stageOptions) *provider[T] {
-	p := &provider[T]{
+	return &provider[T]{
 		commonStage: commonStage[T]{
 			opts:        opts,
 			emitToOutCh: true,
@@ -186,18 +220,6 @@ func buildProvider[T any](fn workFn[T], opts *stageOptions) *provider[T] {
 		},
 		fn: fn,
 	}
-
-	p.getter = func() (out T, ok bool) {
-		select {
-		// case out = <-p.inCh:
-		// 	return out, true
-		// default:
-		// 	return out, false
-		case out, ok = <-p.inCh:
-			return out, ok
-		}
-	}
-	return p
 }
 
 func newProvider[T any](fn workFn[T], optFns ...StageOptionFunc) providerDef[T] {
@@ -211,27 +233,23 @@ func newProvider[T any](fn workFn[T], optFns ...StageOptionFunc) providerDef[T]
 	}
 }
 
-func (p *provider[T]) execute() error {
-	put := func(v T) {
-		if p.emitToOutCh {
-			p.outCh <- v
-		}
-	}
+func (p *provider[T]) execute(ctx context.Context) error {
 	chew := func(v T) {
-		p.inCh <- v
+		select {
+		case p.inCh <- v:
+		case <-ctx.Done():
+		}
 	}
 
-	return p.fn(p.getter, put, chew)
+	return p.fn(p.getter(ctx), p.putter(ctx), chew)
 }
 
-type actionLayerFunc[T any] func(get Get[T], put Put[T], inCh chan T) error
+type actionLayerFunc[T any] func(ctx context.Context, get Get[T], put Put[T], inCh chan T) error
 type actionLayerDef[T any] func() (*actionLayer[T], error)
 
 type actionLayer[T any] struct {
 	commonStage[T]
-	fn  actionLayerFunc[T]
-	put Put[T]
-	get func() (T, bool)
+	fn actionLayerFunc[T]
 }
 
 func newActionLayer[T any](fn actionLayerFunc[T], optFns ...StageOptionFunc) actionLayerDef[T] {
@@ -250,34 +268,33 @@ func newActionLayer[T any](fn actionLayerFunc[T], optFns ...StageOptionFunc) act
 			fn: fn,
 		}
 
-		stage.put = func(v T) {
-			if stage.emitToOutCh {
-				stage.outCh <- v
-			}
-		}
-
-		stage.get = func() (out T, ok bool) {
-			select {
-			case out, ok = <-stage.inCh:
-				return out, ok
-			}
-		}
-
 		return stage, nil
 	}
 }
 
-func (s *actionLayer[T]) executeOnce() (ok bool, err error) {
+type terminalStageKey struct{}
+
+// isTerminalStage reports whether ctx belongs to a stage whose output is discarded.
+func isTerminalStage(ctx context.Context) bool {
+	terminal, _ := ctx.Value(terminalStageKey{}).(bool)
+	return terminal
+}
+
+func (s *actionLayer[T]) executeOnce(ctx context.Context) (ok bool, err error) {
 	var batchOk bool
 
-	err = s.fn(s.get, s.put, s.inCh)
+	if !s.emitToOutCh {
+		ctx = context.WithValue(ctx, terminalStageKey{}, true)
+	}
+
+	err = s.fn(ctx, s.getter(ctx), s.putter(ctx), s.inCh)
 	return batchOk, err
 }
 
-func (s *actionLayer[T]) execute() error {
-	ok, err := s.executeOnce()
+func (s *actionLayer[T]) execute(ctx context.Context) error {
+	ok, err := s.executeOnce(ctx)
 	for ok && err == nil {
-		ok, err = s.executeOnce()
+		ok, err = s.executeOnce(ctx)
 	}
 
 	return err
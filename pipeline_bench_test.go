@@ -1,6 +1,7 @@
 package remilia
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime/trace"
@@ -71,14 +72,14 @@ func BenchmarkPipelineExecution(b *testing.B) {
 					return nil
 				})
 
-				processor := newActionLayer[int](func(get Get[int], put Put[int], inCh chan int) error {
+				processor := newActionLayer[int](func(ctx context.Context, get Get[int], put Put[int], inCh chan int) error {
 					val, _ := get()
 					put(val * 2)
 					return nil
 				}, WithConcurrency(uint(tc.concurrency)))
 
 				pipeline, _ := newPipeline[int](generator, processor)
-				pipeline.execute()
+				pipeline.execute(context.Background())
 			}
 			b.StopTimer()
 			// Explicitly stop tracing to ensure it finishes before closing the file
@@ -166,7 +167,7 @@ func BenchmarkProcessorExecution(b *testing.B) {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					_ = processor.execute()
+					_ = processor.execute(context.Background())
 				}()
 			}
 		})
@@ -1,9 +1,11 @@
 package remilia
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -52,7 +54,7 @@ func TestPipelineExecute(t *testing.T) {
 			return nil
 		})
 
-		processor := newActionLayer[int](func(get Get[int], put Put[int], inCh chan int) error {
+		processor := newActionLayer[int](func(ctx context.Context, get Get[int], put Put[int], inCh chan int) error {
 			arr, _ := get()
 			put(arr * 2)
 			// TODO: chew has bug with closed channel
@@ -61,7 +63,7 @@ func TestPipelineExecute(t *testing.T) {
 		})
 
 		pipeline, _ := newPipeline[int](generator, processor)
-		err := pipeline.execute()
+		err := pipeline.execute(context.Background())
 
 		assert.NoError(t, err, "execute should not return error")
 	})
@@ -72,16 +74,59 @@ func TestPipelineExecute(t *testing.T) {
 			return nil
 		})
 
-		errProcessor := newActionLayer[int](func(get Get[int], put Put[int], inCh chan int) error {
+		errProcessor := newActionLayer[int](func(ctx context.Context, get Get[int], put Put[int], inCh chan int) error {
 			return errors.New("test error")
 		})
 
 		pipeline, _ := newPipeline[int](generator, errProcessor)
-		err := pipeline.execute()
+		err := pipeline.execute(context.Background())
 
 		assert.Error(t, err, "execute should return error")
 		assert.Equal(t, "test error", err.Error(), "execute should return correct error")
 	})
+
+	t.Run("Stop execute when context is cancelled", func(t *testing.T) {
+		generator := newProvider[int](func(get Get[int], put, chew Put[int]) error {
+			put(1)
+			return nil
+		})
+
+		blockingProcessor := newActionLayer[int](func(ctx context.Context, get Get[int], put Put[int], inCh chan int) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		pipeline, _ := newPipeline[int](generator, blockingProcessor)
+		err := pipeline.execute(ctx)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "execute should return the context error")
+	})
+
+	t.Run("Return context error when cancelled before execute", func(t *testing.T) {
+		generator := newProvider[int](func(get Get[int], put, chew Put[int]) error {
+			put(1)
+			return nil
+		})
+
+		processor := newActionLayer[int](func(ctx context.Context, get Get[int], put Put[int], inCh chan int) error {
+			for {
+				if _, ok := get(); !ok {
+					return nil
+				}
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		pipeline, _ := newPipeline[int](generator, processor)
+		err := pipeline.execute(ctx)
+
+		assert.ErrorIs(t, err, context.Canceled, "execute should return the context error")
+	})
 }
 
 type mockExecutor struct {
@@ -89,8 +134,8 @@ type mockExecutor struct {
 	mock.Mock
 }
 
-func (m *mockExecutor) execute() error {
-	args := m.Called()
+func (m *mockExecutor) execute(ctx context.Context) error {
+	args := m.Called(ctx)
 	return args.Error(0)
 }
 
@@ -113,12 +158,12 @@ func TestExecutor(t *testing.T) {
 		mockExec := new(mockExecutor)
 		eg := new(errgroup.Group)
 
-		mockExec.On("execute").Return(nil)
+		mockExec.On("execute", mock.Anything).Return(nil)
 		mockExec.On("outputChannelCloser").Return(func() {})
 		mockExec.On("exhaustInputChannel").Return()
 		mockExec.On("concurrency").Return(uint(1))
 
-		execute(eg, mockExec)
+		execute(context.Background(), eg, mockExec)
 		err := eg.Wait()
 
 		assert.NoError(t, err, "execute should not return error")
@@ -129,12 +174,12 @@ func TestExecutor(t *testing.T) {
 		mockExec := new(mockExecutor)
 		eg := new(errgroup.Group)
 
-		mockExec.On("execute").Return(errors.New("test execute error"))
+		mockExec.On("execute", mock.Anything).Return(errors.New("test execute error"))
 		mockExec.On("outputChannelCloser").Return(func() {})
 		mockExec.On("exhaustInputChannel").Return()
 		mockExec.On("concurrency").Return(uint(1))
 
-		execute(eg, mockExec)
+		execute(context.Background(), eg, mockExec)
 		err := eg.Wait()
 
 		assert.Error(t, err, "execute should return error")
@@ -277,7 +322,7 @@ func TestProcessor(t *testing.T) {
 				close(receiver.inCh)
 				wg.Done()
 			}()
-			err := processor.execute()
+			err := processor.execute(context.Background())
 			assert.NoError(t, err, "Processor should not return error")
 		}()
 
@@ -331,7 +376,7 @@ func TestProcessor(t *testing.T) {
 				close(processor.inCh)
 				wg.Done()
 			}()
-			err := processor.execute()
+			err := processor.execute(context.Background())
 			assert.NoError(t, err, "Processor should not return error")
 		}()
 
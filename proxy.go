@@ -0,0 +1,319 @@
+package remilia
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/proxy"
+)
+
+var (
+	errInvalidProxy          = errors.New("invalid proxy")
+	errNoProxyAvailable      = errors.New("no proxy available")
+	errProxyFailed           = errors.New("proxy failed")
+	errProxyUnsupported      = errors.New("internal client does not support proxies")
+	errInvalidProxySelection = errors.New("invalid proxy selection")
+	errInvalidProxyFailures  = errors.New("invalid proxy max failures")
+	errInvalidEjectDuration  = errors.New("invalid proxy eject duration")
+)
+
+var (
+	defaultProxyMaxFailures   = 3
+	defaultProxyEjectDuration = time.Minute
+)
+
+// parseProxy parses a proxy URL. Supported schemes are http, which tunnels
+// with CONNECT, and socks5. A URL without a scheme is an http proxy.
+func parseProxy(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		// host:port is parsed as a scheme and an opaque part
+		u, err = url.Parse("http://" + rawURL)
+	}
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", errInvalidProxy, rawURL)
+	}
+
+	switch u.Scheme {
+	case "http", "socks5":
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %s", errInvalidProxy, u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("%w: missing port in %s", errInvalidProxy, rawURL)
+	}
+
+	return u, nil
+}
+
+// ProxySelection decides which proxy of a pool sends a request.
+type ProxySelection int
+
+const (
+	// RoundRobinProxy cycles through the proxies.
+	RoundRobinProxy ProxySelection = iota
+	// RandomProxy picks a random proxy for every request.
+	RandomProxy
+	// StickyProxy sends the requests to a host through the same proxy, as
+	// long as it isn't ejected.
+	StickyProxy
+)
+
+type poolProxy struct {
+	url          *url.URL
+	failures     int
+	ejectedUntil time.Time
+}
+
+// ProxyPool rotates requests over a set of proxies. A proxy failing
+// MaxFailures times in a row is ejected for EjectDuration, then tried again.
+type ProxyPool struct {
+	selection     ProxySelection
+	maxFailures   int
+	ejectDuration time.Duration
+	random        randomWrapper
+	now           func() time.Time
+
+	mu      sync.Mutex
+	proxies []*poolProxy
+	next    int
+	sticky  map[string]*poolProxy
+}
+
+type ProxyPoolOptionFunc optionFunc[*ProxyPool]
+
+// NewProxyPool returns a pool of the given proxy URLs.
+func NewProxyPool(proxies []string, opts ...ProxyPoolOptionFunc) (*ProxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, errInvalidProxy
+	}
+
+	p := &ProxyPool{
+		selection:     RoundRobinProxy,
+		maxFailures:   defaultProxyMaxFailures,
+		ejectDuration: defaultProxyEjectDuration,
+		random:        defaultRandomStruct,
+		now:           time.Now,
+		sticky:        make(map[string]*poolProxy),
+	}
+
+	for _, raw := range proxies {
+		u, err := parseProxy(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &poolProxy{url: u})
+	}
+
+	for _, optFn := range opts {
+		if err := optFn(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// WithProxySelection sets how the pool picks the proxy of a request.
+func WithProxySelection(selection ProxySelection) ProxyPoolOptionFunc {
+	return func(p *ProxyPool) error {
+		if selection < RoundRobinProxy || selection > StickyProxy {
+			return errInvalidProxySelection
+		}
+		p.selection = selection
+		return nil
+	}
+}
+
+// WithProxyMaxFailures sets how many consecutive failures eject a proxy.
+func WithProxyMaxFailures(n int) ProxyPoolOptionFunc {
+	return func(p *ProxyPool) error {
+		if n <= 0 {
+			return errInvalidProxyFailures
+		}
+		p.maxFailures = n
+		return nil
+	}
+}
+
+// WithProxyEjectDuration sets how long an ejected proxy is left out of the rotation.
+func WithProxyEjectDuration(d time.Duration) ProxyPoolOptionFunc {
+	return func(p *ProxyPool) error {
+		if d <= 0 {
+			return errInvalidEjectDuration
+		}
+		p.ejectDuration = d
+		return nil
+	}
+}
+
+func withProxyPoolRandom(random randomWrapper) ProxyPoolOptionFunc {
+	return func(p *ProxyPool) error {
+		p.random = random
+		return nil
+	}
+}
+
+func withProxyPoolClock(now func() time.Time) ProxyPoolOptionFunc {
+	return func(p *ProxyPool) error {
+		p.now = now
+		return nil
+	}
+}
+
+// available returns the proxies which are not ejected.
+func (p *ProxyPool) available(now time.Time) []*poolProxy {
+	available := make([]*poolProxy, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.ejectedUntil) {
+			available = append(available, proxy)
+		}
+	}
+	return available
+}
+
+// pick returns the proxy of a request to host.
+func (p *ProxyPool) pick(host string) (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	available := p.available(now)
+	if len(available) == 0 {
+		return nil, errNoProxyAvailable
+	}
+
+	switch p.selection {
+	case RandomProxy:
+		return available[p.random.Int63n(int64(len(available)))].url, nil
+	case StickyProxy:
+		host = normalizeHost(host)
+		if proxy, ok := p.sticky[host]; ok && !now.Before(proxy.ejectedUntil) {
+			return proxy.url, nil
+		}
+		h := fnv.New32a()
+		h.Write([]byte(host))
+		proxy := available[int(h.Sum32()%uint32(len(available)))]
+		p.sticky[host] = proxy
+		return proxy.url, nil
+	default:
+		proxy := available[p.next%len(available)]
+		p.next++
+		return proxy.url, nil
+	}
+}
+
+// report records the result of a request sent through proxyURL.
+func (p *ProxyPool) report(proxyURL *url.URL, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, proxy := range p.proxies {
+		if proxy.url != proxyURL {
+			continue
+		}
+
+		if err == nil {
+			proxy.failures = 0
+			return
+		}
+		proxy.failures++
+		if proxy.failures >= p.maxFailures {
+			proxy.failures = 0
+			proxy.ejectedUntil = p.now().Add(p.ejectDuration)
+		}
+		return
+	}
+}
+
+// proxyDialer returns a dial function which connects to addr through proxyURL,
+// reaching the proxy with direct and bounding the CONNECT handshake by
+// connectTimeout if it's positive.
+func proxyDialer(proxyURL *url.URL, direct fasthttp.DialFunc, connectTimeout time.Duration) fasthttp.DialFunc {
+	if proxyURL.Scheme == "socks5" {
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialFunc(direct))
+		return func(addr string) (net.Conn, error) {
+			if err != nil {
+				return nil, proxyError(proxyURL, err)
+			}
+			conn, err := dialer.Dial("tcp", addr)
+			if err != nil {
+				return nil, proxyError(proxyURL, err)
+			}
+			return conn, nil
+		}
+	}
+
+	return func(addr string) (net.Conn, error) {
+		conn, err := direct(proxyURL.Host)
+		if err != nil {
+			return nil, proxyError(proxyURL, err)
+		}
+		if err := connectTunnel(conn, proxyURL, addr, connectTimeout); err != nil {
+			conn.Close()
+			return nil, proxyError(proxyURL, err)
+		}
+		return conn, nil
+	}
+}
+
+// proxyError marks err as a failure to go through proxyURL, which the
+// circuit breaker of the target host doesn't count.
+func proxyError(proxyURL *url.URL, err error) error {
+	return fmt.Errorf("%w %s: %w", errProxyFailed, proxyURL.Redacted(), err)
+}
+
+// dialFunc adapts a fasthttp dial function into a proxy.Dialer.
+type dialFunc fasthttp.DialFunc
+
+func (fn dialFunc) Dial(_, addr string) (net.Conn, error) {
+	return fn(addr)
+}
+
+// connectTunnel asks the http proxy behind conn to tunnel to addr.
+func connectTunnel(conn net.Conn, proxyURL *url.URL, addr string, timeout time.Duration) error {
+	if timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	req += "\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return err
+	}
+
+	// The proxy sends nothing after its response until the tunnel is used,
+	// so the reader doesn't swallow any bytes of the target
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("refused to connect to %s: %s", addr, resp.Status)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package remilia
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -20,6 +21,32 @@ func (realClock) Sleep(d time.Duration) {
 	time.Sleep(d)
 }
 
+func (realClock) SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// contextClock is implemented by clocks whose sleep can be interrupted by a context.
+type contextClock interface {
+	SleepContext(ctx context.Context, d time.Duration) error
+}
+
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if cc, ok := clock.(contextClock); ok {
+		return cc.SleepContext(ctx, d)
+	}
+
+	clock.Sleep(d)
+	return ctx.Err()
+}
+
 type Limiter interface {
 	Take() (bool, time.Duration)
 }
@@ -43,13 +70,14 @@ type RateLimitation struct {
 	fillInterval   time.Duration
 }
 
+// NewBucket builds a token bucket. Unless set, the bucket starts full.
 func NewBucket(optFns ...RateLimitionOptionFunc) (*RateLimitation, error) {
 	bucket := &RateLimitation{
 		clock:          defaultClock,
 		capacity:       defaultCapacity,
 		fillInterval:   defaultFillInterval,
 		fillQuantum:    defaultFillQuantum,
-		initAvailToken: defaultInitiallyAvailToken,
+		initAvailToken: -1,
 	}
 
 	for _, optFn := range optFns {
@@ -58,40 +86,71 @@ func NewBucket(optFns ...RateLimitionOptionFunc) (*RateLimitation, error) {
 		}
 	}
 
+	if err := bucket.validate(); err != nil {
+		return nil, err
+	}
+
 	bucket.lastestTime = bucket.clock.Now()
-	if bucket.initAvailToken > bucket.capacity {
+	if bucket.initAvailToken < 0 {
 		bucket.initAvailToken = bucket.capacity
 	}
 
 	return bucket, nil
 }
 
+// validate checks the combination of the options, which are only known once all of them ran.
+func (b *RateLimitation) validate() error {
+	switch {
+	case b.capacity <= 0:
+		return errInvalidCapacity
+	case b.fillInterval <= 0:
+		return errInvalidFillInterval
+	case b.fillQuantum <= 0:
+		return errInvalidFillQuantum
+	case b.initAvailToken > b.capacity:
+		return errInvalidInitAvailToken
+	}
+	return nil
+}
+
+// Take removes count tokens from the bucket and returns how long the caller
+// has to wait for them. Tokens missing from the bucket are reserved, so that
+// the following callers queue behind this one.
 func (b *RateLimitation) Take(count int64) time.Duration {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	now := b.clock.Now()
-	elapsed := now.Sub(b.lastestTime)
-	intervals := int64(elapsed / b.fillInterval)
-	newTokens := intervals * b.fillQuantum
+	if elapsed := now.Sub(b.lastestTime); elapsed > 0 {
+		// Only whole intervals are added, the rest of the elapsed time counts towards the next one
+		intervals := int64(elapsed / b.fillInterval)
+		b.lastestTime = b.lastestTime.Add(time.Duration(intervals) * b.fillInterval)
+		if intervals >= b.capacity || b.initAvailToken+intervals*b.fillQuantum >= b.capacity {
+			b.initAvailToken = b.capacity
+		} else {
+			b.initAvailToken += intervals * b.fillQuantum
+		}
+	}
 
-	b.lastestTime = now
-	avail := b.initAvailToken + newTokens
-	if avail >= b.capacity {
-		avail = b.capacity
+	// Tokens left over by a reservation only become available when it ends
+	ready := now
+	if b.lastestTime.After(now) {
+		ready = b.lastestTime
 	}
 
-	avail = avail - count
+	avail := b.initAvailToken - count
 	if avail >= 0 {
 		b.initAvailToken = avail
-		return 0
-	} else {
-		endTime := b.lastestTime.Add(time.Duration(-avail/b.fillQuantum) * (b.fillInterval))
-		b.initAvailToken = 0
-		b.lastestTime = endTime
-
-		return endTime.Sub(now)
+		return ready.Sub(now)
 	}
+
+	// Wait for enough whole intervals to cover the missing tokens
+	deficit := -avail
+	intervals := (deficit + b.fillQuantum - 1) / b.fillQuantum
+	b.lastestTime = b.lastestTime.Add(time.Duration(intervals) * b.fillInterval)
+	b.initAvailToken = intervals*b.fillQuantum - deficit
+
+	return b.lastestTime.Sub(now)
 }
 
 func (b *RateLimitation) Wrap(op func() error) ExecutableFunc {
@@ -104,6 +163,24 @@ func (b *RateLimitation) Wrap(op func() error) ExecutableFunc {
 	}
 }
 
+// WrapContext is like Wrap, but gives up waiting for a token and returns
+// ctx.Err() without calling op once ctx is done.
+func (b *RateLimitation) WrapContext(ctx context.Context, op func() error) ExecutableFunc {
+	return func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		wait := b.Take(1)
+		if wait > 0 {
+			if err := sleepContext(ctx, b.clock, wait); err != nil {
+				return err
+			}
+		}
+		return op()
+	}
+}
+
 type RateLimitionOptionFunc func(*RateLimitation) error
 
 func withLimitationClock(clock Clock) RateLimitionOptionFunc {
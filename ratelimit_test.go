@@ -1,6 +1,7 @@
 package remilia
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -55,6 +56,35 @@ func TestRatelimit(t *testing.T) {
 		assert.Equal(t, 10*time.Nanosecond, bucket.fillInterval, "NewBucket() should set the custom fill interval")
 		assert.Equal(t, int64(100), bucket.initAvailToken, "NewBucket() should set the custom initially available token")
 	})
+
+	t.Run("Start full unless the initially available token is set", func(t *testing.T) {
+		bucket, err := NewBucket(withLimitationCapacity(5))
+
+		assert.NoError(t, err, "NewBucket() should not return an error")
+		assert.Equal(t, int64(5), bucket.initAvailToken, "NewBucket() should start with a full bucket")
+	})
+
+	t.Run("Failed to build with invalid combinations", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			opts     []RateLimitionOptionFunc
+			expected error
+		}{
+			{"Zero capacity", []RateLimitionOptionFunc{withLimitationCapacity(0)}, errInvalidCapacity},
+			{"Zero fill interval", []RateLimitionOptionFunc{withLimitationFillInterval(0)}, errInvalidFillInterval},
+			{"Zero fill quantum", []RateLimitionOptionFunc{withLimitationFillQuantum(0)}, errInvalidFillQuantum},
+			{"Initially available token above capacity", []RateLimitionOptionFunc{withLimitationInitiallyAvailToken(10), withLimitationCapacity(5)}, errInvalidInitAvailToken},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				bucket, err := NewBucket(tt.opts...)
+
+				assert.Nil(t, bucket, "NewBucket() should return a nil bucket")
+				assert.Equal(t, tt.expected, err)
+			})
+		}
+	})
 }
 
 // TestRateLimitationViaTake and TestRateLimitationViaWrap assess the rate limiting via different APIs.
@@ -117,6 +147,56 @@ func TestRateLimitationViaTake(t *testing.T) {
 		// After 2ns, there are 3 tokens in the bucket, so we need to wait for 0ns
 		assert.Equal(t, 0*time.Nanosecond, duration, "Take() should return 0 nanosecond")
 	})
+
+	t.Run("Deficit smaller than the fill quantum waits a whole interval", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+
+		bucket, _ := NewBucket(
+			withLimitationClock(mockClock),
+			withLimitationCapacity(1),
+			withLimitationFillQuantum(10),
+			withLimitationFillInterval(time.Second),
+		)
+
+		assert.Equal(t, time.Duration(0), bucket.Take(1), "First take should use the available token")
+		assert.Equal(t, time.Second, bucket.Take(1), "Second take should wait for the next interval")
+		assert.Equal(t, time.Second, bucket.Take(1), "Tokens of the reserved interval should be shared")
+	})
+
+	t.Run("Back-to-back takes queue behind each other", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+
+		bucket, _ := NewBucket(
+			withLimitationClock(mockClock),
+			withLimitationCapacity(1),
+			withLimitationFillQuantum(1),
+			withLimitationFillInterval(time.Second),
+		)
+
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, time.Duration(i)*time.Second, bucket.Take(1), "Take %d should wait for its own interval", i)
+		}
+	})
+
+	t.Run("Partial intervals are not lost", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0)).Twice()
+		mockClock.On("Now").Return(time.Unix(0, int64(600*time.Millisecond))).Once()
+		mockClock.On("Now").Return(time.Unix(1, int64(200*time.Millisecond))).Once()
+
+		bucket, _ := NewBucket(
+			withLimitationClock(mockClock),
+			withLimitationCapacity(1),
+			withLimitationFillQuantum(1),
+			withLimitationFillInterval(time.Second),
+		)
+
+		bucket.Take(1)
+		assert.Equal(t, 400*time.Millisecond, bucket.Take(1), "Take should wait for the rest of the interval")
+		assert.Equal(t, 800*time.Millisecond, bucket.Take(1), "Take should queue behind the reservation")
+	})
 }
 
 func TestRateLimitationViaWrap(t *testing.T) {
@@ -164,3 +244,65 @@ func TestRateLimitationViaWrap(t *testing.T) {
 		mockClock.AssertExpectations(t)
 	})
 }
+
+func TestRateLimitationViaWrapContext(t *testing.T) {
+	t.Run("No wait, success operation", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0)).Twice()
+
+		bucket, _ := NewBucket(
+			withLimitationClock(mockClock),
+			withLimitationCapacity(10),
+			withLimitationFillQuantum(1),
+			withLimitationFillInterval(1*time.Nanosecond),
+			withLimitationInitiallyAvailToken(10),
+		)
+
+		called := false
+		err := bucket.WrapContext(context.Background(), func() error {
+			called = true
+			return nil
+		})()
+
+		assert.NoError(t, err, "WrapContext should not return an error")
+		assert.True(t, called, "WrapContext should call the operation")
+		mockClock.AssertExpectations(t)
+	})
+
+	t.Run("Cancelled context skips operation", func(t *testing.T) {
+		bucket, _ := NewBucket()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		called := false
+		err := bucket.WrapContext(ctx, func() error {
+			called = true
+			return nil
+		})()
+
+		assert.ErrorIs(t, err, context.Canceled, "WrapContext should return the context error")
+		assert.False(t, called, "WrapContext should not call the operation")
+	})
+
+	t.Run("Cancelled context interrupts wait", func(t *testing.T) {
+		bucket, _ := NewBucket(
+			withLimitationCapacity(1),
+			withLimitationFillQuantum(1),
+			withLimitationFillInterval(time.Hour),
+			withLimitationInitiallyAvailToken(0),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		called := false
+		err := bucket.WrapContext(ctx, func() error {
+			called = true
+			return nil
+		})()
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "WrapContext should return the context error")
+		assert.False(t, called, "WrapContext should not call the operation")
+	})
+}
@@ -0,0 +1,86 @@
+package remilia
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	errTooManyRedirects    = errors.New("too many redirects")
+	errInvalidRedirect     = errors.New("invalid redirect location")
+	errInvalidMaxRedirects = errors.New("invalid max redirects")
+)
+
+// defaultMaxRedirects is how many redirects a request follows, like with net/http.
+var defaultMaxRedirects = 10
+
+func isRedirect(code int) bool {
+	switch code {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusFound, fasthttp.StatusSeeOther,
+		fasthttp.StatusTemporaryRedirect, fasthttp.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// responseCookies returns the cookies set by resp.
+func responseCookies(resp *fasthttp.Response) []*http.Cookie {
+	header := make(http.Header)
+	resp.Header.VisitAllCookie(func(_, value []byte) {
+		header.Add("Set-Cookie", string(value))
+	})
+	return (&http.Response{Header: header}).Cookies()
+}
+
+// redirectRequest points req to the location of the redirect resp. Like
+// browsers, 301, 302 and 303 turn requests other than HEAD into GET without a
+// body, while 307 and 308 resend them as they are. Credentials aren't sent to
+// another host, and the cookies of jar, if any, replace the ones of req.
+func redirectRequest(req *fasthttp.Request, resp *fasthttp.Response, jar *CookieJar) error {
+	from, err := url.Parse(req.URI().String())
+	if err != nil {
+		return err
+	}
+	location, err := url.Parse(string(resp.Header.Peek(fasthttp.HeaderLocation)))
+	if err != nil {
+		return errInvalidRedirect
+	}
+	to := from.ResolveReference(location)
+	if to.Scheme != "http" && to.Scheme != "https" {
+		return errInvalidRedirect
+	}
+
+	if jar != nil {
+		jar.SetCookies(from, responseCookies(resp))
+	}
+
+	switch resp.StatusCode() {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusFound, fasthttp.StatusSeeOther:
+		if !req.Header.IsHead() {
+			req.Header.SetMethod(fasthttp.MethodGet)
+			req.ResetBody()
+			req.Header.SetContentLength(0)
+			req.Header.Del(fasthttp.HeaderContentType)
+		}
+	}
+
+	if to.Host != from.Host {
+		req.Header.Del(fasthttp.HeaderAuthorization)
+		if jar == nil {
+			req.Header.DelAllCookies()
+		}
+	}
+	req.SetRequestURI(to.String())
+
+	if jar != nil {
+		req.Header.DelAllCookies()
+		for _, cookie := range jar.Cookies(to) {
+			req.Header.SetCookie(cookie.Name, cookie.Value)
+		}
+	}
+
+	return nil
+}
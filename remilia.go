@@ -1,7 +1,10 @@
 package remilia
 
 import (
-	"log"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
 	"os"
 	"time"
 
@@ -26,7 +29,7 @@ func (fs fileSystem) OpenFile(name string, flag int, perm os.FileMode) (*os.File
 }
 
 type httpClient interface {
-	execute(request *Request) (*Response, error)
+	execute(ctx context.Context, request *Request) (*Response, error)
 }
 
 type Remilia struct {
@@ -37,6 +40,15 @@ type Remilia struct {
 	logger             Logger
 	urlMatcher         func(s string) bool
 	globalStageOptions []StageOptionFunc
+	seen               SeenStore
+	stats              crawlStats
+	normalizer         *urlNormalizer
+	maxDepth           uint
+	scope              *scopePolicy
+	frontier           Frontier
+	itemOpts           *itemOptions
+	auth               *authenticator
+	clientOpts         []ClientOptionFunc
 }
 
 func New(opts ...RemiliaOptionFunc) (*Remilia, error) {
@@ -53,25 +65,35 @@ func New(opts ...RemiliaOptionFunc) (*Remilia, error) {
 		var err error
 		r.logger, err = createLogger(logConfig, &fileSystem{})
 		if err != nil {
-			log.Printf("Error: Failed to create instance of the struct due to: %v", err)
+			return nil, err
 		}
 	}
 
 	// TODO: should I move the url mather to client?
 	r.urlMatcher = urlMatcher()
+	r.seen = NewMemorySeenStore()
+	r.normalizer = newURLNormalizer()
+	r.scope = newScopePolicy()
+	r.itemOpts = &itemOptions{workers: 1, batchSize: defaultItemBatchSize}
 
 	for _, opt := range opts {
-		opt(r)
+		if err := opt(r); err != nil {
+			return nil, err
+		}
 	}
 
+	// The client is built once every option is known, so that client options
+	// passed in several WithClientOptions calls are combined
 	if r.client == nil {
-		client, err := newClient(
-			withInternalClient(newFastHTTPClient()),
+		clientOpts := append([]ClientOptionFunc{
+			withInternalClient(newFastHTTPTransport()),
 			withDocumentCreator(&defaultDocumentCreator{}),
 			withClientLogger(r.logger),
-		)
+		}, r.clientOpts...)
+
+		client, err := newClient(clientOpts...)
 		if err != nil {
-			log.Printf("Error: Failed to create instance of the struct due to: %v", err)
+			return nil, err
 		}
 
 		r.client = client
@@ -87,79 +109,250 @@ func (r *Remilia) justWrappedFunc(urlStr string) func(get Get[*Request], put Put
 		if err != nil {
 			return err
 		}
-		put(req)
+
+		r.seed(req, put)
 		return nil
 	}
 }
 
-func (r *Remilia) createWrappedPut(put Put[*Request]) Put[string] {
-	return func(in string) {
-		if !r.urlMatcher(in) {
+// seed schedules a seed request. The seed is always fetched, but recorded so
+// that links back to it are dropped.
+func (r *Remilia) seed(req *Request, put Put[*Request]) {
+	req.mergeQuery()
+	if normalized, err := r.normalizer.normalize(nil, string(req.URL)); err == nil {
+		req.key = requestKey(req, normalized)
+		r.visit(req.key)
+	}
+
+	r.schedule(req)
+	put(req)
+}
+
+// schedule checkpoints req into the frontier as pending.
+func (r *Remilia) schedule(req *Request) {
+	if r.frontier == nil {
+		return
+	}
+
+	if err := r.frontier.Push(req); err != nil {
+		r.logger.Error("Failed to checkpoint request", logContext{
+			"url": string(req.URL),
+			"err": err,
+		})
+	}
+}
+
+// complete checkpoints req into the frontier as completed.
+func (r *Remilia) complete(req *Request) {
+	if r.frontier == nil {
+		return
+	}
+
+	if err := r.frontier.Done(req); err != nil {
+		r.logger.Error("Failed to checkpoint request", logContext{
+			"url": string(req.URL),
+			"err": err,
+		})
+	}
+}
+
+// visit reports whether url has not been scheduled before, and records it.
+func (r *Remilia) visit(url string) bool {
+	if r.seen == nil {
+		return true
+	}
+
+	ok, err := r.seen.Visit(url)
+	if err != nil {
+		r.logger.Error("Failed to check seen url", logContext{
+			"url": url,
+			"err": err,
+		})
+		return true
+	}
+
+	if ok {
+		r.stats.unique.Add(1)
+	} else {
+		r.stats.duplicates.Add(1)
+	}
+
+	return ok
+}
+
+// requestKey returns the key req is deduplicated by. GET requests are the same
+// when their URLs are, HEAD requests also need the same method, so that a HEAD
+// check doesn't drop the GET which follows it, other requests also need the same body.
+func requestKey(req *Request, normalized string) string {
+	method := string(req.Method)
+	switch method {
+	case "", fasthttp.MethodGet:
+		return normalized
+	case fasthttp.MethodHead:
+		return method + " " + normalized
+	}
+
+	sum := sha256.Sum256(req.Body)
+	return method + " " + normalized + " " + hex.EncodeToString(sum[:])
+}
+
+// createWrappedPut returns a Put which turns the links found in the document
+// fetched by parent into GET requests. Relative links are resolved against base.
+func (r *Remilia) createWrappedPut(put Put[*Request], parent *Request, base *url.URL) Put[string] {
+	return linkPut(r.createRequestPut(put, parent, base))
+}
+
+// linkPut returns a Put which turns every link into a GET request handed to put.
+func linkPut(put Put[*Request]) Put[string] {
+	return func(link string) {
+		req, err := newRequest(withURL(link))
+		if err != nil {
+			return
+		}
+		put(req)
+	}
+}
+
+// createRequestPut returns a Put which schedules the requests discovered in the
+// document fetched by parent. Relative URLs are resolved against base.
+func (r *Remilia) createRequestPut(put Put[*Request], parent *Request, base *url.URL) Put[*Request] {
+	return func(req *Request) {
+		req.mergeQuery()
+		in := string(req.URL)
+		normalized, err := r.normalizer.normalize(base, in)
+		if err != nil {
+			r.logger.Error("Failed to normalize url", logContext{
+				"url": in,
+				"err": err,
+			})
+			return
+		}
+
+		if !r.urlMatcher(normalized) {
 			r.logger.Error("Failed to match url", logContext{
 				"url": in,
 			})
 			return
 		}
 
-		req, err := newRequest(withURL(in))
-		if err != nil {
-			r.logger.Error("Failed to create request", logContext{
-				"err": err,
+		if r.scope != nil {
+			if u, err := url.Parse(normalized); err == nil {
+				if err := r.scope.check(u); err != nil {
+					r.stats.outOfScope.Add(1)
+					r.logger.Info("Dropped request", logContext{
+						"url":    normalized,
+						"reason": err.Error(),
+					})
+					return
+				}
+			}
+		}
+
+		if r.maxDepth > 0 && parent != nil && parent.Depth+1 > r.maxDepth {
+			r.stats.depthExceeded.Add(1)
+			return
+		}
+
+		req.key = requestKey(req, normalized)
+		if !r.visit(req.key) {
+			r.logger.Debug("Skipped duplicate url", logContext{
+				"url": normalized,
 			})
 			return
 		}
 
+		if err := withURL(normalized)(req); err != nil {
+			return
+		}
+		if err := withParent(parent)(req); err != nil {
+			return
+		}
+
+		r.schedule(req)
 		put(req)
 	}
 }
 
-func (r *Remilia) worker(done <-chan struct{}, requests <-chan *Request) <-chan *Response {
+// Stats returns a snapshot of the crawl counters.
+func (r *Remilia) Stats() Stats {
+	return r.stats.snapshot()
+}
+
+func (r *Remilia) worker(ctx context.Context, requests <-chan *Request, forward Put[*Request]) <-chan *Response {
 	responses := make(chan *Response, 100)
 	go func() {
 		defer close(responses)
 		for {
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return
 			case req, ok := <-requests:
 				if !ok {
 					return
 				}
-				resp, err := r.client.execute(req)
+
+				if req.skip > 0 {
+					req.skip--
+					forward(req)
+					continue
+				}
+
+				resp, err := r.fetch(ctx, req)
 				if err != nil {
+					// A cancelled request stays pending, so that it is fetched again on resume
+					if ctx.Err() == nil {
+						r.complete(req)
+					}
 					continue
 				}
-				responses <- resp
+
+				select {
+				case <-ctx.Done():
+					return
+				case responses <- resp:
+				}
 			}
 		}
 	}()
 	return responses
 }
 
-func (r *Remilia) createWorkers(done <-chan struct{}, requests <-chan *Request, numWorkers int) []<-chan *Response {
+func (r *Remilia) createWorkers(ctx context.Context, requests <-chan *Request, forward Put[*Request], numWorkers int) []<-chan *Response {
 	workers := make([]<-chan *Response, numWorkers)
 	for i := 0; i < numWorkers; i++ {
-		workers[i] = r.worker(done, requests)
+		workers[i] = r.worker(ctx, requests, forward)
 	}
 
 	return workers
 }
 
-func (r *Remilia) wrapLayerFunc(fn func(in *goquery.Document, put Put[string])) actionLayerFunc[*Request] {
-	return func(get Get[*Request], put Put[*Request], inCh chan *Request) error {
-		wrappedPut := r.createWrappedPut(put)
+// layerHandler processes one response of a layer, discovering requests with put and
+// emitting scraped items with emit.
+type layerHandler func(resp *Response, put Put[*Request], emit Put[Item])
+
+func (r *Remilia) wrapLayerFunc(fn layerHandler) actionLayerFunc[*Request] {
+	return func(ctx context.Context, get Get[*Request], put Put[*Request], inCh chan *Request) error {
+		terminal := isTerminalStage(ctx)
+		emit := itemEmitter(ctx)
 
-		done := make(chan struct{})
-		defer close(done)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 
-		workers := r.createWorkers(done, inCh, 1)
-		mergedResponses := fanIn(done, workers...)
+		workers := r.createWorkers(ctx, inCh, put, 1)
+		mergedResponses := fanIn(ctx.Done(), workers...)
 
 		for resp := range mergedResponses {
-			fn(resp.document, wrappedPut)
+			// Links found by the last layer are never fetched, so they are not scheduled
+			wrappedPut := Put[*Request](func(*Request) {})
+			if !terminal {
+				wrappedPut = r.createRequestPut(put, resp.Request, documentBase(resp.document, resp.URL))
+			}
+
+			fn(resp, wrappedPut, emit)
+			r.complete(resp.Request)
 		}
 
-		return nil
+		return ctx.Err()
 	}
 }
 
@@ -167,21 +360,154 @@ func (r *Remilia) URLProvider(urlStr string) providerDef[*Request] {
 	return newProvider[*Request](r.justWrappedFunc(urlStr))
 }
 
+// RequestProvider seeds the crawl with requests built by NewRequest.
+func (r *Remilia) RequestProvider(reqs ...*Request) providerDef[*Request] {
+	return newProvider[*Request](func(get Get[*Request], put Put[*Request], chew Put[*Request]) error {
+		for _, req := range reqs {
+			r.seed(req, put)
+		}
+		return nil
+	})
+}
+
+// documentHandler adapts a handler of HTML documents, skipping the
+// responses which have none, e.g. JSON APIs or images.
+func documentHandler(fn layerHandler) layerHandler {
+	return func(resp *Response, put Put[*Request], emit Put[Item]) {
+		if resp.document == nil {
+			return
+		}
+		fn(resp, put, emit)
+	}
+}
+
 type LayerFunc func(in *goquery.Document, put Put[string])
 
 func (r *Remilia) AddLayer(fn LayerFunc, opts ...StageOptionFunc) actionLayerDef[*Request] {
 	combinedOpts := append(r.globalStageOptions, opts...)
 
-	return newActionLayer[*Request](r.wrapLayerFunc(fn), combinedOpts...)
+	handler := documentHandler(func(resp *Response, put Put[*Request], emit Put[Item]) {
+		fn(resp.document, linkPut(put))
+	})
+
+	return newActionLayer[*Request](r.wrapLayerFunc(handler), combinedOpts...)
 }
 
+// ItemLayerFunc is like LayerFunc, but can also emit scraped items, which are
+// handed to the item pipeline configured with WithItemPipeline.
+type ItemLayerFunc func(in *goquery.Document, put Put[string], emit Put[Item])
+
+func (r *Remilia) AddItemLayer(fn ItemLayerFunc, opts ...StageOptionFunc) actionLayerDef[*Request] {
+	combinedOpts := append(r.globalStageOptions, opts...)
+
+	handler := documentHandler(func(resp *Response, put Put[*Request], emit Put[Item]) {
+		fn(resp.document, linkPut(put), emit)
+	})
+
+	return newActionLayer[*Request](r.wrapLayerFunc(handler), combinedOpts...)
+}
+
+// RequestLayerFunc is like LayerFunc, but puts full requests, e.g. form
+// submissions built with NewRequest. Relative request URLs are resolved
+// against the document.
+type RequestLayerFunc func(in *goquery.Document, put Put[*Request])
+
+func (r *Remilia) AddRequestLayer(fn RequestLayerFunc, opts ...StageOptionFunc) actionLayerDef[*Request] {
+	combinedOpts := append(r.globalStageOptions, opts...)
+
+	handler := documentHandler(func(resp *Response, put Put[*Request], emit Put[Item]) {
+		fn(resp.document, put)
+	})
+
+	return newActionLayer[*Request](r.wrapLayerFunc(handler), combinedOpts...)
+}
+
+// ResponseLayerFunc receives every response, whatever its content type, e.g.
+// to walk a JSON API with resp.JSON() or a feed with resp.XML(). Relative
+// request URLs are resolved against the response URL.
+type ResponseLayerFunc func(resp *Response, put Put[*Request], emit Put[Item])
+
+func (r *Remilia) AddResponseLayer(fn ResponseLayerFunc, opts ...StageOptionFunc) actionLayerDef[*Request] {
+	combinedOpts := append(r.globalStageOptions, opts...)
+
+	return newActionLayer[*Request](r.wrapLayerFunc(layerHandler(fn)), combinedOpts...)
+}
+
+// Do runs the crawl described by the provider and layers until it is exhausted.
 func (r *Remilia) Do(pd providerDef[*Request], stageDefs ...actionLayerDef[*Request]) error {
+	return r.DoContext(context.Background(), pd, stageDefs...)
+}
+
+// DoContext is like Do, but stops the crawl when ctx is cancelled or its deadline
+// expires. Pending rate limiter waits and retry sleeps are interrupted, no new
+// requests are sent, the pipeline is drained and ctx.Err() is returned.
+// Items emitted by the layers are processed concurrently, and DoContext only
+// returns once all of them went through the item pipeline and the item sinks were flushed.
+// With WithLogin, the default session logs in before the provider starts.
+func (r *Remilia) DoContext(ctx context.Context, pd providerDef[*Request], stageDefs ...actionLayerDef[*Request]) error {
 	pipeline, err := newPipeline[*Request](pd, stageDefs...)
 	if err != nil {
 		return err
 	}
 
-	return pipeline.execute()
+	if r.auth != nil {
+		if err := r.auth.authenticate(ctx, r.client, "", r.auth.generation("")); err != nil {
+			return err
+		}
+	}
+
+	if !r.itemOpts.enabled() {
+		return pipeline.execute(ctx)
+	}
+
+	items := newItemPipeline(r.itemOpts, r.logger, &r.stats)
+	items.start()
+
+	err = pipeline.execute(context.WithValue(ctx, itemEmitterKey{}, items.emitter(ctx)))
+	if flushErr := items.wait(); err == nil {
+		err = flushErr
+	}
+
+	return err
+}
+
+// Resume continues a crawl checkpointed into the frontier configured with WithFrontier.
+// Visited URLs are restored into the seen store, and every pending request is sent
+// to the layer which discovered it, so the layers must be the same as the ones of
+// the interrupted crawl.
+func (r *Remilia) Resume(ctx context.Context, stageDefs ...actionLayerDef[*Request]) error {
+	if r.frontier == nil {
+		return errNoFrontier
+	}
+
+	visited, err := r.frontier.Visited()
+	if err != nil {
+		return err
+	}
+	// The seen set is restored directly, so that the stats only count the requests of this run
+	if r.seen != nil {
+		for _, key := range visited {
+			if _, err := r.seen.Visit(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	pending, err := r.frontier.Pending()
+	if err != nil {
+		return err
+	}
+
+	provider := newProvider[*Request](func(get Get[*Request], put Put[*Request], chew Put[*Request]) error {
+		for _, req := range pending {
+			// A request of depth n was discovered by the n-th layer and is processed by the next one
+			req.skip = req.Depth
+			put(req)
+		}
+		return nil
+	})
+
+	return r.DoContext(ctx, provider, stageDefs...)
 }
 
 func newFastHTTPClient() *fasthttp.Client {
@@ -190,42 +516,116 @@ func newFastHTTPClient() *fasthttp.Client {
 		WriteTimeout:             10 * time.Second,
 		NoDefaultUserAgentHeader: true,
 		MaxConnsPerHost:          5120,
-		// TODO: figure out how to set timeout for TCP connection
-		// Dial: fasthttpproxy.FasthttpHTTPDialer("127.0.0.1:8888"),
 	}
 }
 
-type RemiliaOptionFunc func(*Remilia)
+type RemiliaOptionFunc optionFunc[*Remilia]
 
+// WithClientOptions configures the client sending the requests. Invalid
+// options make New return their error.
 func WithClientOptions(opts ...ClientOptionFunc) RemiliaOptionFunc {
-	return func(r *Remilia) {
-		client, err := newClient(
-			withInternalClient(newFastHTTPClient()),
-			withDocumentCreator(&defaultDocumentCreator{}),
-			withClientLogger(r.logger),
-		)
-		if err != nil {
-			log.Printf("Error: Failed to create instance of the struct due to: %v", err)
+	return func(r *Remilia) error {
+		r.clientOpts = append(r.clientOpts, opts...)
+		return nil
+	}
+}
+
+func WithLayerOptions(opts ...StageOptionFunc) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.globalStageOptions = opts
+		return nil
+	}
+}
+
+// WithMaxDepth drops the requests which are more than depth hops away from the seed.
+// The number of dropped requests is reported by Stats. Zero means no limit.
+func WithMaxDepth(depth uint) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.maxDepth = depth
+		return nil
+	}
+}
+
+// WithStripTrackingParams removes well-known tracking parameters such as utm_source
+// and gclid, as well as any extra parameters, from discovered URLs.
+func WithStripTrackingParams(extra ...string) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.normalizer.addStripParams(defaultTrackingParams...)
+		r.normalizer.addStripParams(extra...)
+		return nil
+	}
+}
+
+// WithFrontier checkpoints every scheduled and completed request into frontier,
+// so that an interrupted crawl can be continued with Resume.
+func WithFrontier(frontier Frontier) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.frontier = frontier
+		return nil
+	}
+}
+
+// WithItemPipeline sets the stages every item emitted by an item layer goes through, in order.
+func WithItemPipeline(stages ...ItemStage) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.itemOpts.stages = append(r.itemOpts.stages, stages...)
+		return nil
+	}
+}
+
+// WithItemWorkers sets how many items are processed concurrently. Items keep
+// their emission order only with a single worker, which is the default.
+func WithItemWorkers(workers uint) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		if workers > 0 {
+			r.itemOpts.workers = workers
 		}
+		return nil
+	}
+}
 
-		for _, opt := range opts {
-			if err := opt(client); err != nil {
-				log.Printf("Error: Failed to create instance of the struct due to: %v", err)
-			}
+// WithItemSinks writes every item which went through the item pipeline to sinks.
+// Items are written in batches, and the sinks are flushed when Do returns.
+// Batches a sink failed to write are returned by Do as *SinkError, holding the
+// lost items. Closing the sinks is up to the caller.
+func WithItemSinks(sinks ...ItemSink) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.itemOpts.sinks = append(r.itemOpts.sinks, sinks...)
+		return nil
+	}
+}
+
+// WithItemBatchSize sets how many items are buffered before they are written to the sinks.
+func WithItemBatchSize(size uint) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		if size > 0 {
+			r.itemOpts.batchSize = size
 		}
+		return nil
+	}
+}
 
-		r.client = client
+// WithLogin runs login before the crawl starts. Responses for which expired
+// returns true make the session log in again, after which the request is
+// replayed once. Sessions other than the default one log in on first expiry.
+func WithLogin(login LoginFunc, expired SessionExpiredFunc) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.auth = newAuthenticator(login, expired)
+		return nil
 	}
 }
 
-func WithLayerOptions(opts ...StageOptionFunc) RemiliaOptionFunc {
-	return func(r *Remilia) {
-		r.globalStageOptions = opts
+// WithSeenStore replaces the in-memory store used to drop URLs which were already scheduled.
+func WithSeenStore(store SeenStore) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.seen = store
+		return nil
 	}
 }
 
 func WithLogger(logger Logger) RemiliaOptionFunc {
-	return func(r *Remilia) {
+	return func(r *Remilia) error {
 		r.logger = logger
+		return nil
 	}
 }
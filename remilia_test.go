@@ -1,6 +1,13 @@
 package remilia
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,6 +30,27 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, instance.urlMatcher, "New() should return an instance with a non-nil urlMatcher")
 }
 
+func TestNewWithClientOptions(t *testing.T) {
+	t.Run("Combine client options", func(t *testing.T) {
+		instance, err := New(
+			WithClientOptions(WithTimeout(time.Second)),
+			WithClientOptions(WithCapacity(5)),
+		)
+
+		assert.NoError(t, err, "New() should not return an error")
+		client := instance.client.(*Client)
+		assert.Equal(t, time.Second, client.timeout, "Options of the first call should be applied")
+		assert.Equal(t, int64(5), client.rateLimitation.capacity, "Options of the second call should be applied")
+	})
+
+	t.Run("Surface invalid client options", func(t *testing.T) {
+		instance, err := New(WithClientOptions(WithInitiallyAvailToken(200)))
+
+		assert.Nil(t, instance, "New() should return a nil instance")
+		assert.Equal(t, errInvalidInitAvailToken, err, "New() should return the configuration error")
+	})
+}
+
 func TestNewRemilia(t *testing.T) {
 	t.Run("With default client and logger", func(t *testing.T) {
 		instance, err := New()
@@ -87,14 +115,14 @@ type mockHTTPClient struct {
 	mock.Mock
 }
 
-func (m *mockHTTPClient) execute(request *Request) (*Response, error) {
-	args := m.Called(request)
+func (m *mockHTTPClient) execute(ctx context.Context, request *Request) (*Response, error) {
+	args := m.Called(ctx, request)
 	return args.Get(0).(*Response), args.Error(1)
 }
 
 func setupWrappedFuncTest(t *testing.T) (*Remilia, *observer.ObservedLogs) {
 	mockClient := new(mockHTTPClient)
-	mockClient.On("execute", mock.Anything).Return(&Response{
+	mockClient.On("execute", mock.Anything, mock.Anything).Return(&Response{
 		document: &goquery.Document{},
 	}, nil)
 
@@ -117,7 +145,7 @@ func TestDo(t *testing.T) {
 		return nil
 	}
 
-	stageFunc := func(get Get[*Request], put Put[*Request], inCh chan *Request) error {
+	stageFunc := func(ctx context.Context, get Get[*Request], put Put[*Request], inCh chan *Request) error {
 		return nil
 	}
 
@@ -125,3 +153,443 @@ func TestDo(t *testing.T) {
 
 	assert.NoError(t, err, "Do should not return an error")
 }
+
+func TestDoContext(t *testing.T) {
+	instance, _ := New()
+
+	processorFunc := func(get Get[*Request], put, chew Put[*Request]) error {
+		return nil
+	}
+
+	stageFunc := func(ctx context.Context, get Get[*Request], put Put[*Request], inCh chan *Request) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := instance.DoContext(ctx, newProvider(processorFunc), newActionLayer(stageFunc))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "DoContext should return the context error")
+}
+
+func TestCreateWrappedPut(t *testing.T) {
+	setup := func(t *testing.T) (*Remilia, *observer.ObservedLogs, *[]*Request) {
+		instance, recorded := setupWrappedFuncTest(t)
+		instance.urlMatcher = urlMatcher()
+		instance.seen = NewMemorySeenStore()
+		instance.normalizer = newURLNormalizer()
+
+		requests := make([]*Request, 0)
+		return instance, recorded, &requests
+	}
+
+	t.Run("Put valid url", func(t *testing.T) {
+		instance, _, requests := setup(t)
+		put := instance.createWrappedPut(func(req *Request) {
+			*requests = append(*requests, req)
+		}, nil, nil)
+
+		put("http://example.com/page#section")
+
+		assert.Len(t, *requests, 1, "put should forward 1 request")
+		assert.Equal(t, []byte("http://example.com/page"), (*requests)[0].URL, "put should forward the normalized url")
+	})
+
+	t.Run("Put relative url resolved against the document", func(t *testing.T) {
+		instance, _, requests := setup(t)
+		base, _ := url.Parse("http://example.com/page/1")
+		put := instance.createWrappedPut(func(req *Request) {
+			*requests = append(*requests, req)
+		}, nil, base)
+
+		put("/page/2")
+		put("3")
+
+		assert.Len(t, *requests, 2, "put should forward 2 requests")
+		assert.Equal(t, []byte("http://example.com/page/2"), (*requests)[0].URL, "put should resolve root relative url")
+		assert.Equal(t, []byte("http://example.com/page/3"), (*requests)[1].URL, "put should resolve path relative url")
+	})
+
+	t.Run("Drop invalid url", func(t *testing.T) {
+		instance, recorded, requests := setup(t)
+		put := instance.createWrappedPut(func(req *Request) {
+			*requests = append(*requests, req)
+		}, nil, nil)
+
+		put("not_a_url")
+
+		assert.Empty(t, *requests, "put should not forward invalid url")
+		assert.Equal(t, 1, recorded.FilterMessage("Failed to match url").Len(), "Invalid url should be logged")
+	})
+
+	t.Run("Drop duplicated url", func(t *testing.T) {
+		instance, _, requests := setup(t)
+		put := instance.createWrappedPut(func(req *Request) {
+			*requests = append(*requests, req)
+		}, nil, nil)
+
+		put("http://example.com/page")
+		put("http://example.com/page#other")
+		put("http://example.com/other")
+
+		assert.Len(t, *requests, 2, "put should drop the duplicated url")
+		assert.Equal(t, Stats{Unique: 2, Duplicates: 1}, instance.Stats(), "Stats should count the duplicate")
+	})
+
+	t.Run("Drop url pointing back to the seed", func(t *testing.T) {
+		instance, _, requests := setup(t)
+		put := func(req *Request) {
+			*requests = append(*requests, req)
+		}
+
+		err := instance.justWrappedFunc("http://example.com")(nil, put, nil)
+		assert.NoError(t, err, "justFunc should not return an error")
+
+		instance.createWrappedPut(put, nil, nil)("http://example.com")
+
+		assert.Len(t, *requests, 1, "Only the seed request should be forwarded")
+		assert.Equal(t, uint64(1), instance.Stats().Duplicates, "Stats should count the duplicate")
+	})
+}
+
+func TestCreateWrappedPutDepth(t *testing.T) {
+	setup := func(t *testing.T, maxDepth uint) (*Remilia, *[]*Request, Put[*Request]) {
+		instance, _ := setupWrappedFuncTest(t)
+		instance.urlMatcher = urlMatcher()
+		instance.seen = NewMemorySeenStore()
+		instance.normalizer = newURLNormalizer()
+		instance.maxDepth = maxDepth
+
+		requests := make([]*Request, 0)
+		return instance, &requests, func(req *Request) {
+			requests = append(requests, req)
+		}
+	}
+
+	t.Run("Record depth and parent url", func(t *testing.T) {
+		instance, requests, put := setup(t, 0)
+		parent, _ := newRequest(withURL("http://example.com/"))
+		parent.Depth = 2
+
+		instance.createWrappedPut(put, parent, nil)("http://example.com/child")
+
+		assert.Len(t, *requests, 1, "put should forward 1 request")
+		assert.Equal(t, uint(3), (*requests)[0].Depth, "Depth should be one more than the parent")
+		assert.Equal(t, []byte("http://example.com/"), (*requests)[0].ParentURL, "ParentURL should be the parent url")
+	})
+
+	t.Run("Drop requests deeper than max depth", func(t *testing.T) {
+		instance, requests, put := setup(t, 2)
+		shallow, _ := newRequest(withURL("http://example.com/"))
+		shallow.Depth = 1
+		deep, _ := newRequest(withURL("http://example.com/deep"))
+		deep.Depth = 2
+
+		instance.createWrappedPut(put, shallow, nil)("http://example.com/a")
+		instance.createWrappedPut(put, deep, nil)("http://example.com/b")
+		instance.createWrappedPut(put, deep, nil)("http://example.com/c")
+
+		assert.Len(t, *requests, 1, "put should only forward the request within max depth")
+		assert.Equal(t, []byte("http://example.com/a"), (*requests)[0].URL, "put should forward the shallow request")
+		assert.Equal(t, uint64(2), instance.Stats().DepthExceeded, "Stats should count the dropped requests")
+		assert.Equal(t, uint64(1), instance.Stats().Unique, "Dropped requests should not be marked as seen")
+	})
+}
+
+type fakeHTTPClient struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (f *fakeHTTPClient) execute(ctx context.Context, request *Request) (*Response, error) {
+	f.mu.Lock()
+	f.urls = append(f.urls, string(request.URL))
+	f.mu.Unlock()
+
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(`<a href="/a"></a><a href="/b"></a>`))
+	return &Response{
+		Request:  request,
+		URL:      string(request.URL),
+		document: doc,
+	}, nil
+}
+
+type funcHTTPClient func(ctx context.Context, request *Request) (*Response, error)
+
+func (f funcHTTPClient) execute(ctx context.Context, request *Request) (*Response, error) {
+	return f(ctx, request)
+}
+
+func TestAddRequestLayer(t *testing.T) {
+	instance, _ := New()
+	client := &fakeHTTPClient{}
+	instance.client = client
+
+	search := func(in *goquery.Document, put Put[*Request]) {
+		for _, q := range []string{"tea", "coffee", "tea"} {
+			req, _ := NewRequest("POST", "/search", WithRequestForm(url.Values{"q": {q}}))
+			put(req)
+		}
+	}
+	noop := func(in *goquery.Document, put Put[string]) {}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddRequestLayer(search), instance.AddLayer(noop))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.Equal(t, []string{"http://example.com/", "http://example.com/search", "http://example.com/search"}, client.urls, "Requests with different bodies should both be fetched")
+	assert.Equal(t, uint64(1), instance.Stats().Duplicates, "The repeated request should be dropped")
+}
+
+func TestAddRequestLayerQueryParams(t *testing.T) {
+	instance, _ := New()
+	client := &fakeHTTPClient{}
+	instance.client = client
+
+	list := func(in *goquery.Document, put Put[*Request]) {
+		for _, page := range []string{"1", "2", "3", "1"} {
+			req, _ := NewRequest("GET", "/list", WithRequestQueryParam("page", page))
+			put(req)
+		}
+	}
+	noop := func(in *goquery.Document, put Put[string]) {}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddRequestLayer(list), instance.AddLayer(noop))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.ElementsMatch(t, []string{
+		"http://example.com/",
+		"http://example.com/list?page=1",
+		"http://example.com/list?page=2",
+		"http://example.com/list?page=3",
+	}, client.urls, "Requests with different query params should all be fetched")
+	assert.Equal(t, uint64(1), instance.Stats().Duplicates, "The repeated page should be dropped")
+}
+
+func TestAddRequestLayerHeadThenGet(t *testing.T) {
+	instance, _ := New()
+	client := &fakeHTTPClient{}
+	instance.client = client
+
+	check := func(in *goquery.Document, put Put[*Request]) {
+		for _, method := range []string{"HEAD", "GET", "HEAD"} {
+			req, _ := NewRequest(method, "/file")
+			put(req)
+		}
+	}
+	noop := func(in *goquery.Document, put Put[string]) {}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddRequestLayer(check), instance.AddLayer(noop))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.ElementsMatch(t, []string{"http://example.com/", "http://example.com/file", "http://example.com/file"}, client.urls, "The GET should not be dropped after the HEAD")
+	assert.Equal(t, uint64(1), instance.Stats().Duplicates, "The repeated HEAD should be dropped")
+}
+
+func TestFrontierCheckpoint(t *testing.T) {
+	t.Run("Checkpoint scheduled and completed requests", func(t *testing.T) {
+		frontier, err := NewFileFrontier(filepath.Join(t.TempDir(), "frontier.log"))
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		instance, _ := New(WithFrontier(frontier))
+		instance.client = &fakeHTTPClient{}
+
+		linkParser := func(in *goquery.Document, put Put[string]) {
+			in.Find("a").Each(func(i int, s *goquery.Selection) {
+				href, _ := s.Attr("href")
+				put(href)
+			})
+		}
+
+		err = instance.Do(
+			instance.URLProvider("http://example.com/"),
+			instance.AddLayer(linkParser),
+			instance.AddLayer(linkParser),
+		)
+		assert.NoError(t, err, "Do should not return an error")
+
+		pending, _ := frontier.Pending()
+		assert.Empty(t, pending, "Every request should be completed")
+
+		visited, _ := frontier.Visited()
+		assert.ElementsMatch(t, []string{"http://example.com/", "http://example.com/a", "http://example.com/b"}, visited, "Every scheduled request should be visited")
+	})
+
+	t.Run("Resume pending requests in the layer which discovered them", func(t *testing.T) {
+		frontier, err := NewFileFrontier(filepath.Join(t.TempDir(), "frontier.log"))
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		seed, _ := newRequest(withURL("http://example.com/"))
+		pending, _ := newRequest(withURL("http://example.com/a"), withParent(seed))
+		frontier.Push(seed)
+		frontier.Push(pending)
+		frontier.Done(seed)
+
+		client := &fakeHTTPClient{}
+		instance, _ := New(WithFrontier(frontier))
+		instance.client = client
+
+		var mu sync.Mutex
+		firstCalls, secondCalls := 0, 0
+		first := instance.AddLayer(func(in *goquery.Document, put Put[string]) {
+			mu.Lock()
+			firstCalls++
+			mu.Unlock()
+		})
+		second := instance.AddLayer(func(in *goquery.Document, put Put[string]) {
+			mu.Lock()
+			secondCalls++
+			mu.Unlock()
+			put("http://example.com/")
+		})
+		third := instance.AddLayer(func(in *goquery.Document, put Put[string]) {})
+
+		err = instance.Resume(context.Background(), first, second, third)
+		assert.NoError(t, err, "Resume should not return an error")
+
+		assert.Equal(t, []string{"http://example.com/a"}, client.urls, "Only the pending request should be fetched")
+		assert.Equal(t, 0, firstCalls, "First layer should not process the resumed request")
+		assert.Equal(t, 1, secondCalls, "Second layer should process the resumed request")
+		assert.Equal(t, uint64(0), instance.Stats().Unique, "Restored requests should not count as unique")
+		assert.Equal(t, uint64(1), instance.Stats().Duplicates, "Links to visited requests should be dropped")
+
+		remaining, _ := frontier.Pending()
+		assert.Empty(t, remaining, "Resumed request should be completed")
+	})
+
+	t.Run("Resume requests to the same URL with different bodies", func(t *testing.T) {
+		frontier, err := NewFileFrontier(filepath.Join(t.TempDir(), "frontier.log"))
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		search := func(in *goquery.Document, put Put[*Request]) {
+			for _, q := range []string{"tea", "coffee"} {
+				req, _ := NewRequest("POST", "/search", WithRequestForm(url.Values{"q": {q}}))
+				put(req)
+			}
+		}
+		noop := func(in *goquery.Document, put Put[string]) {}
+
+		// The crawl dies once it starts fetching the searches, leaving both pending
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		crashed, _ := New(WithFrontier(frontier))
+		crashed.client = funcHTTPClient(func(ctx context.Context, request *Request) (*Response, error) {
+			if string(request.Method) == "POST" {
+				cancel()
+				return nil, context.Canceled
+			}
+			return (&fakeHTTPClient{}).execute(ctx, request)
+		})
+		crashed.DoContext(ctx, crashed.URLProvider("http://example.com/"), crashed.AddRequestLayer(search), crashed.AddLayer(noop))
+
+		pending, _ := frontier.Pending()
+		assert.Len(t, pending, 2, "Both searches should be pending")
+
+		var mu sync.Mutex
+		var bodies []string
+		resumed, _ := New(WithFrontier(frontier))
+		resumed.client = funcHTTPClient(func(ctx context.Context, request *Request) (*Response, error) {
+			mu.Lock()
+			bodies = append(bodies, string(request.Body))
+			mu.Unlock()
+			return (&fakeHTTPClient{}).execute(ctx, request)
+		})
+
+		err = resumed.Resume(context.Background(), resumed.AddRequestLayer(search), resumed.AddLayer(noop))
+		assert.NoError(t, err, "Resume should not return an error")
+		assert.ElementsMatch(t, []string{"q=tea", "q=coffee"}, bodies, "Both searches should be fetched")
+	})
+
+	t.Run("Resume requests with their options", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.log")
+		frontier, err := NewFileFrontier(path)
+		assert.NoError(t, err)
+
+		timeouts := Timeouts{Connect: time.Second, Total: 5 * time.Second}
+		seed, _ := newRequest(withURL("http://example.com/"))
+		pending, _ := NewRequest("GET", "http://example.com/list",
+			WithRequestQueryParam("page", "2"),
+			WithRequestTimeouts(timeouts),
+			WithRequestMaxAttempts(2),
+			WithRequestProxy("http://127.0.0.1:8080"),
+			withParent(seed),
+		)
+		frontier.Push(seed)
+		frontier.Push(pending)
+		frontier.Done(seed)
+		assert.NoError(t, frontier.Close())
+
+		// Reopen the log, so that the request is read back from the records
+		frontier, err = NewFileFrontier(path)
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		var resumedRequest *Request
+		instance, _ := New(WithFrontier(frontier))
+		instance.client = funcHTTPClient(func(ctx context.Context, request *Request) (*Response, error) {
+			resumedRequest = request
+			return (&fakeHTTPClient{}).execute(ctx, request)
+		})
+		noop := func(in *goquery.Document, put Put[string]) {}
+
+		err = instance.Resume(context.Background(), instance.AddLayer(noop), instance.AddLayer(noop), instance.AddLayer(noop))
+		assert.NoError(t, err, "Resume should not return an error")
+
+		if assert.NotNil(t, resumedRequest, "the pending request should be fetched") {
+			assert.Equal(t, "page=2", resumedRequest.QueryParams.String(), "QueryParams should be restored")
+			assert.Equal(t, timeouts, resumedRequest.Timeouts, "Timeouts should be restored")
+			assert.Equal(t, uint8(2), resumedRequest.MaxAttempts, "MaxAttempts should be restored")
+			assert.Equal(t, "http://127.0.0.1:8080", resumedRequest.Proxy, "Proxy should be restored")
+		}
+	})
+
+	t.Run("Resume without frontier", func(t *testing.T) {
+		instance, _ := New()
+		err := instance.Resume(context.Background())
+		assert.Equal(t, errNoFrontier, err, "Resume should return errNoFrontier")
+	})
+}
+
+func TestAddResponseLayer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"pages":["/page","/data"]}`))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/from-page"></a>`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	instance, err := New()
+	assert.NoError(t, err)
+
+	api := func(resp *Response, put Put[*Request], emit Put[Item]) {
+		for _, page := range resp.JSON().(map[string]any)["pages"].([]any) {
+			req, _ := NewRequest("GET", page.(string))
+			put(req)
+		}
+	}
+	var documents []string
+	var mu sync.Mutex
+	links := func(in *goquery.Document, put Put[string]) {
+		mu.Lock()
+		documents = append(documents, in.Url.Path)
+		mu.Unlock()
+	}
+
+	err = instance.Do(instance.URLProvider(server.URL+"/api"), instance.AddResponseLayer(api), instance.AddLayer(links))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.Equal(t, []string{"/page"}, documents, "document layers should skip responses without a document")
+	assert.Equal(t, uint64(3), instance.Stats().Unique, "requests put by the response layer should be fetched")
+}
@@ -1,61 +1,289 @@
 package remilia
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/valyala/fasthttp"
 )
 
+// Request is a request the crawl sends. Seeds are usually built with
+// NewRequest, discovered requests are created from the links put by a layer.
 type Request struct {
 	Method      []byte
 	URL         []byte
 	Headers     *fasthttp.Args
 	Body        []byte
 	QueryParams *fasthttp.Args
+
+	// Depth is the number of hops between the seed request and this one.
+	Depth uint
+	// ParentURL is the URL of the page this request was discovered on.
+	ParentURL []byte
+	// Session selects the cookie jar of the request. Requests discovered on
+	// a page inherit the session of the request which fetched it.
+	Session string
+	// Timeouts overrides the non-zero timeouts of the client for this request.
+	Timeouts Timeouts
+	// MaxAttempts overrides the number of attempts of the client for this request.
+	MaxAttempts uint8
+	// Proxy sends the request through this proxy instead of the ones of the client.
+	Proxy string
+
+	// skip is the number of layers which forward the request untouched,
+	// so that a resumed request reaches the layer which discovered it.
+	skip uint
+	// key is the key the crawl deduplicates the request by, set when it's scheduled.
+	key string
+}
+
+// Key returns the key the crawl deduplicates the request by: its normalized
+// URL including the query parameters, plus its method unless it's a GET, and a
+// hash of its body unless it's a GET or HEAD. Frontiers key their records by it.
+// Before the request is scheduled, it's the URL.
+func (req *Request) Key() string {
+	if req.key != "" {
+		return req.key
+	}
+	return string(req.URL)
+}
+
+// mergeQuery moves the query parameters of req into its URL, so that the URL
+// alone names the target the request is deduplicated and checkpointed by.
+func (req *Request) mergeQuery() {
+	if req.QueryParams == nil || req.QueryParams.Len() == 0 {
+		return
+	}
+
+	target, fragment := string(req.URL), ""
+	if idx := strings.IndexByte(target, '#'); idx >= 0 {
+		target, fragment = target[:idx], target[idx:]
+	}
+	switch {
+	case !strings.Contains(target, "?"):
+		target += "?"
+	case !strings.HasSuffix(target, "?") && !strings.HasSuffix(target, "&"):
+		target += "&"
+	}
+
+	req.URL = append(req.URL[:0], target+req.QueryParams.String()+fragment...)
+	req.QueryParams.Reset()
 }
 
-type requestOption func(*Request) error
+type RequestOptionFunc func(*Request) error
+
+var validMethods = map[string]struct{}{
+	fasthttp.MethodGet:     {},
+	fasthttp.MethodHead:    {},
+	fasthttp.MethodPost:    {},
+	fasthttp.MethodPut:     {},
+	fasthttp.MethodPatch:   {},
+	fasthttp.MethodDelete:  {},
+	fasthttp.MethodOptions: {},
+}
 
-func withMethod(method string) requestOption {
+func withMethod(method string) RequestOptionFunc {
 	return func(req *Request) error {
-		if method == "GET" || method == "POST" || method == "PUT" || method == "DELETE" {
-			req.Method = append(req.Method[:0], method...)
-			return nil
-		} else {
+		if _, ok := validMethods[method]; !ok {
 			return fmt.Errorf("invalid method: %s", method)
 		}
+		req.Method = append(req.Method[:0], method...)
+		return nil
 	}
 }
 
-func withURL(url string) requestOption {
+func withURL(url string) RequestOptionFunc {
 	return func(req *Request) error {
 		req.URL = append(req.URL[:0], url...)
 		return nil
 	}
 }
 
-func withHeader(key, value string) requestOption {
+func withHeader(key, value string) RequestOptionFunc {
 	return func(req *Request) error {
 		req.Headers.Add(key, value)
 		return nil
 	}
 }
 
-func withBody(body []byte) requestOption {
+func withBody(body []byte) RequestOptionFunc {
 	return func(req *Request) error {
 		req.Body = body
 		return nil
 	}
 }
 
-func withQueryParam(key, value string) requestOption {
+func withQueryParam(key, value string) RequestOptionFunc {
 	return func(req *Request) error {
 		req.QueryParams.Add(key, value)
 		return nil
 	}
 }
 
-func newRequest(opts ...requestOption) (*Request, error) {
+// withParent marks the request as discovered on the page fetched by parent.
+func withParent(parent *Request) RequestOptionFunc {
+	return func(req *Request) error {
+		if parent == nil {
+			return nil
+		}
+		req.Depth = parent.Depth + 1
+		req.ParentURL = append(req.ParentURL[:0], parent.URL...)
+		if req.Session == "" {
+			req.Session = parent.Session
+		}
+		return nil
+	}
+}
+
+// WithRequestHeader adds a header to the request.
+func WithRequestHeader(key, value string) RequestOptionFunc {
+	return withHeader(key, value)
+}
+
+// WithRequestQueryParam adds a query parameter to the request URL.
+func WithRequestQueryParam(key, value string) RequestOptionFunc {
+	return withQueryParam(key, value)
+}
+
+// WithRequestSession sends the request with the cookie jar of session.
+func WithRequestSession(session string) RequestOptionFunc {
+	return func(req *Request) error {
+		req.Session = session
+		return nil
+	}
+}
+
+// WithRequestTimeouts overrides the timeouts of the client for the request.
+func WithRequestTimeouts(timeouts Timeouts) RequestOptionFunc {
+	return func(req *Request) error {
+		if !timeouts.valid() {
+			return errInvalidTimeout
+		}
+		req.Timeouts = timeouts
+		return nil
+	}
+}
+
+// WithRequestMaxAttempts bounds the number of attempts of the request,
+// overriding the max attempt of the client.
+func WithRequestMaxAttempts(attempts uint8) RequestOptionFunc {
+	return func(req *Request) error {
+		if attempts == 0 {
+			return errInvalidMaxAttempts
+		}
+		req.MaxAttempts = attempts
+		return nil
+	}
+}
+
+// WithRequestProxy sends the request through proxyURL, bypassing the proxy pool of the client.
+func WithRequestProxy(proxyURL string) RequestOptionFunc {
+	return func(req *Request) error {
+		if _, err := parseProxy(proxyURL); err != nil {
+			return err
+		}
+		req.Proxy = proxyURL
+		return nil
+	}
+}
+
+// WithRequestBody sets the raw body of the request and its content type.
+func WithRequestBody(body []byte, contentType string) RequestOptionFunc {
+	return func(req *Request) error {
+		req.Body = body
+		req.Headers.Set(fasthttp.HeaderContentType, contentType)
+		return nil
+	}
+}
+
+// WithRequestJSON sets the body of the request to v encoded as JSON.
+func WithRequestJSON(v any) RequestOptionFunc {
+	return func(req *Request) error {
+		body, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return WithRequestBody(body, "application/json")(req)
+	}
+}
+
+// WithRequestForm sets the body of the request to the url-encoded form values.
+func WithRequestForm(values url.Values) RequestOptionFunc {
+	return func(req *Request) error {
+		return WithRequestBody([]byte(values.Encode()), "application/x-www-form-urlencoded")(req)
+	}
+}
+
+// MultipartFile is a file uploaded in a multipart body.
+type MultipartFile struct {
+	// Field is the name of the form field.
+	Field string
+	// Name is the file name sent to the server.
+	Name string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Content     []byte
+}
+
+// WithRequestMultipart sets the body of the request to a multipart form made of
+// the fields and files.
+func WithRequestMultipart(fields url.Values, files ...MultipartFile) RequestOptionFunc {
+	return func(req *Request) error {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			for _, value := range fields[key] {
+				if err := writer.WriteField(key, value); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, file := range files {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, file.Field, file.Name))
+			header.Set(fasthttp.HeaderContentType, getOrDefault(&file.ContentType, "application/octet-stream"))
+
+			part, err := writer.CreatePart(header)
+			if err != nil {
+				return err
+			}
+			if _, err := part.Write(file.Content); err != nil {
+				return err
+			}
+		}
+
+		if err := writer.Close(); err != nil {
+			return err
+		}
+
+		return WithRequestBody(body.Bytes(), writer.FormDataContentType())(req)
+	}
+}
+
+// NewRequest builds a request with one of the methods GET, HEAD, POST, PUT,
+// PATCH, DELETE and OPTIONS, which can be seeded with RequestProvider or put
+// by a layer added with AddRequestLayer. The crawl drops a request with the
+// method, URL and query parameters of one scheduled before, and the same body
+// unless it's a GET or HEAD, see Request.Key.
+func NewRequest(method, url string, opts ...RequestOptionFunc) (*Request, error) {
+	return newRequest(append([]RequestOptionFunc{withMethod(method), withURL(url)}, opts...)...)
+}
+
+func newRequest(opts ...RequestOptionFunc) (*Request, error) {
 	req := &Request{
 		Headers:     fasthttp.AcquireArgs(),
 		QueryParams: fasthttp.AcquireArgs(),
@@ -1,6 +1,10 @@
 package remilia
 
 import (
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,7 +13,7 @@ import (
 
 func TestRequestOptions(t *testing.T) {
 	t.Run("WithMethod", func(t *testing.T) {
-		validMethods := []string{"GET", "POST", "PUT", "DELETE"}
+		validMethods := []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 		for _, method := range validMethods {
 			req := &Request{}
 			err := withMethod(method)(req)
@@ -64,6 +68,22 @@ func TestRequestOptions(t *testing.T) {
 		assert.NoError(t, err, "WithQueryParam should not return error")
 		assert.Equal(t, []byte(value), req.QueryParams.Peek(key), "QueryParam should be %s", value)
 	})
+
+	t.Run("WithParent", func(t *testing.T) {
+		parent := &Request{URL: []byte("http://example.com"), Depth: 1}
+		req := &Request{}
+		err := withParent(parent)(req)
+
+		assert.NoError(t, err, "WithParent should not return error")
+		assert.Equal(t, uint(2), req.Depth, "Depth should be 2")
+		assert.Equal(t, parent.URL, req.ParentURL, "ParentURL should be the parent url")
+
+		seed := &Request{}
+		err = withParent(nil)(seed)
+
+		assert.NoError(t, err, "WithParent should not return error")
+		assert.Equal(t, uint(0), seed.Depth, "Depth of a seed should be 0")
+	})
 }
 
 func TestNewRequest(t *testing.T) {
@@ -77,6 +97,47 @@ func TestNewRequest(t *testing.T) {
 	assert.Error(t, err, "NewRequest should return error")
 }
 
+func TestNewRequestBodies(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		req, err := NewRequest("PATCH", "http://example.com", WithRequestJSON(map[string]int{"page": 2}))
+
+		assert.NoError(t, err, "NewRequest should not return error")
+		assert.Equal(t, []byte("PATCH"), req.Method, "Method should be PATCH")
+		assert.Equal(t, []byte(`{"page":2}`), req.Body, "Body should be encoded as JSON")
+		assert.Equal(t, []byte("application/json"), req.Headers.Peek("Content-Type"), "Content type should be set")
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		req, err := NewRequest("POST", "http://example.com", WithRequestForm(url.Values{"q": {"tea cup"}}))
+
+		assert.NoError(t, err, "NewRequest should not return error")
+		assert.Equal(t, []byte("q=tea+cup"), req.Body, "Body should be url-encoded")
+		assert.Equal(t, []byte("application/x-www-form-urlencoded"), req.Headers.Peek("Content-Type"), "Content type should be set")
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		req, err := NewRequest("POST", "http://example.com",
+			WithRequestMultipart(url.Values{"title": {"notes"}}, MultipartFile{Field: "file", Name: "a.txt", Content: []byte("hello")}))
+		assert.NoError(t, err, "NewRequest should not return error")
+
+		mediaType, params, err := mime.ParseMediaType(string(req.Headers.Peek("Content-Type")))
+		assert.NoError(t, err, "Content type should be valid")
+		assert.Equal(t, "multipart/form-data", mediaType, "Content type should be multipart")
+
+		form, err := multipart.NewReader(strings.NewReader(string(req.Body)), params["boundary"]).ReadForm(1024)
+		assert.NoError(t, err, "Body should be a valid multipart form")
+		assert.Equal(t, []string{"notes"}, form.Value["title"], "Fields should be written")
+		assert.Equal(t, "a.txt", form.File["file"][0].Filename, "Files should be written")
+	})
+
+	t.Run("Invalid method", func(t *testing.T) {
+		for _, method := range []string{"FETCH", "CONNECT", "TRACE"} {
+			_, err := NewRequest(method, "http://example.com")
+			assert.Error(t, err, "NewRequest should return error for %s", method)
+		}
+	})
+}
+
 func TestBuild(t *testing.T) {
 	req, err := newRequest(withMethod("GET"), withURL("http://example.com"), withHeader("Content-Type", "application/json"), withBody([]byte(`{"foo":"bar"}`)), withQueryParam("param1", "value1"))
 	assert.NoError(t, err, "NewRequest should not return error")
@@ -87,3 +148,32 @@ func TestBuild(t *testing.T) {
 	assert.Equal(t, []byte("application/json"), fasthttpReq.Header.Peek("Content-Type"), "Header should be application/json")
 	assert.Equal(t, []byte(`{"foo":"bar"}`), fasthttpReq.Body(), "Body should be %s", []byte(`{"foo":"bar"}`))
 }
+
+func TestMergeQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		params   [][2]string
+		expected string
+	}{
+		{"Without params", "http://example.com/list", nil, "http://example.com/list"},
+		{"Without query", "http://example.com/list", [][2]string{{"page", "2"}}, "http://example.com/list?page=2"},
+		{"With query", "http://example.com/list?sort=asc", [][2]string{{"page", "2"}}, "http://example.com/list?sort=asc&page=2"},
+		{"With fragment", "/list#top", [][2]string{{"q", "a b"}}, "/list?q=a+b#top"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []RequestOptionFunc{withURL(tc.url)}
+			for _, param := range tc.params {
+				opts = append(opts, withQueryParam(param[0], param[1]))
+			}
+			req, _ := newRequest(opts...)
+
+			req.mergeQuery()
+
+			assert.Equal(t, tc.expected, string(req.URL), "the params should be moved into the url")
+			assert.Equal(t, 0, req.QueryParams.Len(), "the params should not be sent twice")
+		})
+	}
+}
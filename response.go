@@ -1,9 +1,95 @@
 package remilia
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/PuerkitoBio/goquery"
+	"github.com/valyala/fasthttp"
 )
 
+// Timing records how long each phase of a request took.
+type Timing struct {
+	// Start is the moment the client began executing the request.
+	Start time.Time
+	// Wait is the time spent before the first attempt was sent, including
+	// pre-request hooks and the rate limiter.
+	Wait time.Duration
+	// Transfer is the time the successful attempt spent in the transport.
+	Transfer time.Duration
+	// Parse is the time spent building the document from the body.
+	Parse time.Duration
+	// Total is the time from Start until the response was built.
+	Total time.Duration
+}
+
 type Response struct {
-	document *goquery.Document
+	// Request is the request which produced this response.
+	Request *Request
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Header holds the response headers.
+	Header http.Header
+	// URL is the effective URL of the response, after any redirects.
+	URL string
+	// Body is a copy of the raw response body, before any transformation.
+	Body []byte
+	// Attempts is the number of times the request was sent.
+	Attempts int
+	// Timing holds the per-phase durations of the request.
+	Timing Timing
+	// Charset is the detected charset the body was decoded from, empty when
+	// a transformer set on the client decoded it.
+	Charset string
+	// Proxy is the URL of the proxy which sent the request, without its password.
+	Proxy string
+	// Kind is how the body was parsed, decided from the Content-Type.
+	Kind ContentKind
+	// ParseErr is the error decoding a JSON or XML body, in which case only
+	// the raw Body is available.
+	ParseErr error
+
+	document  *goquery.Document
+	jsonValue any
+	xmlRoot   *XMLNode
+}
+
+// Document returns the parsed HTML document of the response, or nil if the
+// body isn't HTML.
+func (r *Response) Document() *goquery.Document {
+	return r.document
+}
+
+// JSON returns the decoded JSON body, made of maps, slices, strings, bools,
+// json.Number and nil, or nil if the body isn't JSON, is empty or failed to decode.
+func (r *Response) JSON() any {
+	return r.jsonValue
+}
+
+// XML returns the root element of the XML body, or nil if the body isn't XML,
+// is empty or failed to decode.
+func (r *Response) XML() *XMLNode {
+	return r.xmlRoot
+}
+
+// ContentType returns the value of the Content-Type header.
+func (r *Response) ContentType() string {
+	return r.Header.Get("Content-Type")
+}
+
+// newResponse copies everything needed out of resp, so that it is safe to
+// use the result after resp has been released.
+func newResponse(request *Request, req *fasthttp.Request, resp *fasthttp.Response) *Response {
+	header := make(http.Header)
+	resp.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	return &Response{
+		Request:    request,
+		StatusCode: resp.StatusCode(),
+		Header:     header,
+		URL:        req.URI().String(),
+		Body:       append([]byte(nil), resp.Body()...),
+	}
 }
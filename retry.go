@@ -0,0 +1,198 @@
+package remilia
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var defaultMaxRetryAfter = 5 * time.Minute
+
+// RetryAttempt describes a failed attempt of a request.
+type RetryAttempt struct {
+	Request *Request
+	// Attempt is the number of times the request was sent so far.
+	Attempt uint8
+	// Err is the transport error, nil when a response was received.
+	Err error
+	// StatusCode and Header are the ones of the response, if any.
+	StatusCode int
+	Header     http.Header
+}
+
+// RetryPolicy decides which attempts are retried. ShouldRetry also returns
+// how long to wait before the next attempt, zero meaning the backoff delay.
+type RetryPolicy interface {
+	ShouldRetry(attempt RetryAttempt) (bool, time.Duration)
+}
+
+// RetryPolicyFunc adapts a function into a RetryPolicy.
+type RetryPolicyFunc func(attempt RetryAttempt) (bool, time.Duration)
+
+func (fn RetryPolicyFunc) ShouldRetry(attempt RetryAttempt) (bool, time.Duration) {
+	return fn(attempt)
+}
+
+type defaultRetryPolicy struct {
+	maxRetryAfter time.Duration
+	now           func() time.Time
+}
+
+// DefaultRetryPolicy retries transient transport errors, 429 and 5xx responses
+// except 501, and never other responses. A Retry-After header is honored, but
+// a response asking to wait longer than five minutes is not retried.
+func DefaultRetryPolicy() RetryPolicy {
+	return &defaultRetryPolicy{
+		maxRetryAfter: defaultMaxRetryAfter,
+		now:           time.Now,
+	}
+}
+
+func (p *defaultRetryPolicy) ShouldRetry(attempt RetryAttempt) (bool, time.Duration) {
+	if attempt.Err != nil {
+		return isTransientError(attempt.Err), 0
+	}
+
+	if !isRetryableStatus(attempt.StatusCode) {
+		return false, 0
+	}
+
+	delay, ok := parseRetryAfter(attempt.Header.Get("Retry-After"), p.now())
+	if !ok {
+		return true, 0
+	}
+	if delay > p.maxRetryAfter {
+		return false, 0
+	}
+	return true, delay
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// isTransientError reports whether a transport error may go away on its own.
+// Errors which aren't known to be transient, such as invalid settings, are
+// not retried.
+func isTransientError(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, errProxyFailed), errors.Is(err, errNoProxyAvailable):
+		// Another proxy may be picked, or an ejected one may come back
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, fasthttp.ErrTimeout), errors.Is(err, fasthttp.ErrConnectionClosed), errors.Is(err, fasthttp.ErrNoFreeConns),
+		errors.Is(err, fasthttp.ErrDialTimeout), errors.Is(err, fasthttp.ErrTLSHandshakeTimeout):
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) || errors.As(err, &hostname) {
+		return false
+	}
+
+	// Timeouts and failures of the connection, such as a refused dial
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if delay := t.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// statusError is returned by an attempt whose response has a status the retry policy retries.
+type statusError struct {
+	statusCode int
+	delay      time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("retryable status code %d", e.statusCode)
+}
+
+// retryAttemptFromResponse returns the attempt describing resp.
+func retryAttemptFromResponse(request *Request, attempt uint8, resp *fasthttp.Response) RetryAttempt {
+	header := make(http.Header)
+	resp.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	return RetryAttempt{
+		Request:    request,
+		Attempt:    attempt,
+		StatusCode: resp.StatusCode(),
+		Header:     header,
+	}
+}
+
+// retryDecider decides whether a failed attempt is retried and how long to
+// wait before the next one, zero meaning the backoff delay.
+type retryDecider func(attempt uint8, err error) (bool, time.Duration)
+
+// policyDecider decides with policy for transport errors, and with the
+// decision stored in a statusError for responses.
+func policyDecider(policy RetryPolicy, request *Request) retryDecider {
+	return func(attempt uint8, err error) (bool, time.Duration) {
+		var se *statusError
+		if errors.As(err, &se) {
+			return true, se.delay
+		}
+		return policy.ShouldRetry(RetryAttempt{Request: request, Attempt: attempt, Err: err})
+	}
+}
+
+// isHostFailure reports whether err counts against the health of the host.
+// Cancellations, failures of the proxy and redirects dropped by robots.txt say
+// nothing about the host.
+func isHostFailure(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, errProxyFailed), errors.Is(err, errNoProxyAvailable),
+		errors.Is(err, errProxyUnsupported), errors.Is(err, errInvalidProxy):
+		return false
+	case errors.Is(err, errDisallowedByRobots):
+		// A redirect to a disallowed location
+		return false
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package remilia
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := &defaultRetryPolicy{maxRetryAfter: time.Minute, now: func() time.Time { return now }}
+
+	retryAfter := func(value string) http.Header {
+		return http.Header{"Retry-After": []string{value}}
+	}
+
+	testCases := []struct {
+		name    string
+		attempt RetryAttempt
+		retry   bool
+		delay   time.Duration
+	}{
+		{"Timeout", RetryAttempt{Err: fasthttp.ErrTimeout}, true, 0},
+		{"Connection refused", RetryAttempt{Err: &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}}, true, 0},
+		{"Unknown host", RetryAttempt{Err: &net.DNSError{Name: "nowhere.invalid", IsNotFound: true}}, false, 0},
+		{"Temporary DNS failure", RetryAttempt{Err: &net.DNSError{Name: "example.com", IsTemporary: true}}, true, 0},
+		{"Invalid certificate", RetryAttempt{Err: fmt.Errorf("handshake: %w", x509.UnknownAuthorityError{})}, false, 0},
+		{"Cancelled", RetryAttempt{Err: context.Canceled}, false, 0},
+		{"Connection reset", RetryAttempt{Err: fmt.Errorf("read: %w", syscall.ECONNRESET)}, true, 0},
+		{"Connection closed", RetryAttempt{Err: fasthttp.ErrConnectionClosed}, true, 0},
+		{"Unexpected EOF", RetryAttempt{Err: io.ErrUnexpectedEOF}, true, 0},
+		{"Failed proxy", RetryAttempt{Err: fmt.Errorf("%w http://127.0.0.1:1: %w", errProxyFailed, io.EOF)}, true, 0},
+		{"No proxy available", RetryAttempt{Err: errNoProxyAvailable}, true, 0},
+		{"Unsupported proxy", RetryAttempt{Err: errProxyUnsupported}, false, 0},
+		{"Invalid proxy", RetryAttempt{Err: fmt.Errorf("%w: ftp://proxy", errInvalidProxy)}, false, 0},
+		{"Invalid proxy selection", RetryAttempt{Err: errInvalidProxySelection}, false, 0},
+		{"Too many redirects", RetryAttempt{Err: errTooManyRedirects}, false, 0},
+		{"Unknown error", RetryAttempt{Err: errors.New("unknown")}, false, 0},
+		{"Too many requests", RetryAttempt{StatusCode: http.StatusTooManyRequests}, true, 0},
+		{"Service unavailable", RetryAttempt{StatusCode: http.StatusServiceUnavailable}, true, 0},
+		{"Not implemented", RetryAttempt{StatusCode: http.StatusNotImplemented}, false, 0},
+		{"Not found", RetryAttempt{StatusCode: http.StatusNotFound}, false, 0},
+		{"Ok", RetryAttempt{StatusCode: http.StatusOK}, false, 0},
+		{"Retry-After in seconds", RetryAttempt{StatusCode: http.StatusTooManyRequests, Header: retryAfter("2")}, true, 2 * time.Second},
+		{"Retry-After as a date", RetryAttempt{StatusCode: http.StatusServiceUnavailable, Header: retryAfter(now.Add(30 * time.Second).Format(http.TimeFormat))}, true, 30 * time.Second},
+		{"Retry-After too long", RetryAttempt{StatusCode: http.StatusTooManyRequests, Header: retryAfter("3600")}, false, 0},
+		{"Invalid Retry-After", RetryAttempt{StatusCode: http.StatusTooManyRequests, Header: retryAfter("soon")}, true, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retry, delay := policy.ShouldRetry(tc.attempt)
+			assert.Equal(t, tc.retry, retry, "retry decision should match")
+			assert.Equal(t, tc.delay, delay, "delay should match")
+		})
+	}
+}
+
+func TestRetryWithDecider(t *testing.T) {
+	t.Run("Stop on errors which are not retried", func(t *testing.T) {
+		calls := 0
+		eb := &mockExponentialBackoff{MaxAttempt: 5}
+		err := retryWithDecider(context.Background(), func() error {
+			calls++
+			return assert.AnError
+		}, eb, eb.GetMaxAttempt(), func(uint8, error) (bool, time.Duration) {
+			return false, 0
+		})
+
+		assert.ErrorIs(t, err, assert.AnError, "the error of the attempt should be returned")
+		assert.Equal(t, 1, calls, "op should not be retried")
+	})
+
+	t.Run("Bound attempts by max attempts", func(t *testing.T) {
+		calls := 0
+		eb := &mockExponentialBackoff{MaxAttempt: 5}
+		err := retryWithDecider(context.Background(), func() error {
+			calls++
+			return assert.AnError
+		}, eb, 2, func(uint8, error) (bool, time.Duration) {
+			return true, 0
+		})
+
+		assert.Error(t, err, "err should not be nil")
+		assert.Equal(t, 2, calls, "op should run max attempts times")
+	})
+}
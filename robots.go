@@ -0,0 +1,391 @@
+package remilia
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	errDisallowedByRobots = errors.New("disallowed by robots.txt")
+	errRobotsUnreachable  = errors.New("robots.txt unreachable")
+)
+
+var (
+	defaultRobotsTTL          = 24 * time.Hour
+	defaultRobotsErrorTTL     = time.Minute
+	defaultRobotsMaxSize      = 500 * 1024
+	defaultRobotsMaxRedirects = 5
+)
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// newRobotsRule compiles pattern, which supports the "*" wildcard and the
+// "$" end anchor, into a regular expression matched against the URL path.
+func newRobotsRule(allow bool, pattern string) robotsRule {
+	expr := pattern
+	anchored := strings.HasSuffix(expr, "$")
+	if anchored {
+		expr = expr[:len(expr)-1]
+	}
+
+	parts := strings.Split(expr, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr = "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+
+	return robotsRule{
+		allow:   allow,
+		pattern: pattern,
+		re:      regexp.MustCompile(expr),
+	}
+}
+
+func (r robotsRule) match(path string) bool {
+	return r.re.MatchString(path)
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules holds the parsed content of a robots.txt file.
+type robotsRules struct {
+	groups []*robotsGroup
+}
+
+var (
+	allowAllRobots    = &robotsRules{}
+	disallowAllRobots = &robotsRules{
+		groups: []*robotsGroup{{agents: []string{"*"}, rules: []robotsRule{newRobotsRule(false, "/")}}},
+	}
+)
+
+func parseRobots(body []byte) *robotsRules {
+	rules := &robotsRules{}
+
+	var current *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &robotsGroup{}
+				rules.groups = append(rules.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			// An empty disallow rule allows everything, which is the default anyway.
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, newRobotsRule(key == "allow", value))
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	return rules
+}
+
+// groupsFor returns the groups which apply to userAgent: the ones with the
+// longest matching agent token, or the "*" groups when none matches.
+func (rr *robotsRules) groupsFor(userAgent string) []*robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+
+	var matched, wildcard []*robotsGroup
+	best := 0
+	for _, group := range rr.groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				wildcard = append(wildcard, group)
+				continue
+			}
+			if !strings.Contains(userAgent, agent) || len(agent) < best {
+				continue
+			}
+			if len(agent) > best {
+				best = len(agent)
+				matched = matched[:0]
+			}
+			matched = append(matched, group)
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+	return wildcard
+}
+
+// allowed reports whether userAgent may fetch path. The longest matching
+// rule wins, and allow wins over disallow when both are equally long.
+func (rr *robotsRules) allowed(userAgent, path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed := true
+	best := -1
+	for _, group := range rr.groupsFor(userAgent) {
+		for _, rule := range group.rules {
+			if !rule.match(path) {
+				continue
+			}
+			if len(rule.pattern) > best || len(rule.pattern) == best && rule.allow {
+				best = len(rule.pattern)
+				allowed = rule.allow
+			}
+		}
+	}
+
+	return allowed
+}
+
+func (rr *robotsRules) crawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, group := range rr.groupsFor(userAgent) {
+		if group.crawlDelay > delay {
+			delay = group.crawlDelay
+		}
+	}
+	return delay
+}
+
+type robotsEntry struct {
+	ready   chan struct{}
+	rules   *robotsRules
+	expires time.Time
+}
+
+// robotsCache fetches robots.txt once per scheme and host, and keeps it for ttl.
+type robotsCache struct {
+	userAgent string
+	ttl       time.Duration
+	clock     Clock
+	fetch     func(ctx context.Context, robotsURL string) (*robotsRules, error)
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache(userAgent string, fetch func(ctx context.Context, robotsURL string) (*robotsRules, error)) *robotsCache {
+	return &robotsCache{
+		userAgent: userAgent,
+		ttl:       defaultRobotsTTL,
+		clock:     defaultClock,
+		fetch:     fetch,
+		entries:   make(map[string]*robotsEntry),
+	}
+}
+
+// rulesFor returns the rules of the host of u, fetching them when they are
+// missing or expired. Concurrent callers for the same host share one fetch.
+func (rc *robotsCache) rulesFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	rc.mu.Lock()
+	entry, ok := rc.entries[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			if rc.clock.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		rc.entries[key] = entry
+		rc.mu.Unlock()
+
+		rules, err := rc.fetch(ctx, key+"/robots.txt")
+		if ctx.Err() != nil {
+			// The fetch was given up, so the next caller fetches again
+			rc.mu.Lock()
+			if rc.entries[key] == entry {
+				delete(rc.entries, key)
+			}
+			rc.mu.Unlock()
+			close(entry.ready)
+			return nil, ctx.Err()
+		}
+		if rules == nil {
+			rules = allowAllRobots
+		}
+		entry.rules = rules
+		// Retry soon after a failed fetch instead of keeping a transient error for the whole ttl.
+		if err != nil {
+			entry.expires = rc.clock.Now().Add(defaultRobotsErrorTTL)
+		} else {
+			entry.expires = rc.clock.Now().Add(rc.ttl)
+		}
+		close(entry.ready)
+
+		return rules, err
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-entry.ready:
+		if entry.rules == nil {
+			return rc.rulesFor(ctx, u)
+		}
+		return entry.rules, nil
+	}
+}
+
+// fetchRobots downloads robots.txt through the proxies and with the timeouts
+// of the client, and interprets the status code as RFC 9309 describes: a
+// missing file allows everything, while an unreachable one disallows
+// everything. An unreachable file is reported as an error, so that it is
+// fetched again soon.
+func (c *Client) fetchRobots(ctx context.Context, robotsURL string) (*robotsRules, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	req.SetRequestURI(robotsURL)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	if c.robots != nil && c.robots.userAgent != "" {
+		req.Header.SetUserAgent(c.robots.userAgent)
+	}
+
+	timeouts := c.requestTimeouts(&Request{})
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); timeouts.Total == 0 || left < timeouts.Total {
+			timeouts.Total = left
+		}
+	}
+
+	var proxy *url.URL
+	if c.proxies != nil {
+		var err error
+		if proxy, err = c.proxies.pick(string(req.URI().Host())); err != nil {
+			return disallowAllRobots, err
+		}
+	}
+
+	err := c.doRedirects(ctx, req, resp, timeouts, proxy, nil, defaultRobotsMaxRedirects, nil)
+	if proxy != nil {
+		c.proxies.report(proxy, err)
+	}
+	if errors.Is(err, errTooManyRedirects) {
+		// Too many redirects make the file unavailable, like a 4xx status
+		return allowAllRobots, nil
+	}
+	if err != nil {
+		return disallowAllRobots, err
+	}
+
+	switch status := resp.StatusCode(); {
+	case status >= 200 && status < 300:
+		body := resp.Body()
+		if len(body) > defaultRobotsMaxSize {
+			body = body[:defaultRobotsMaxSize]
+		}
+		return parseRobots(body), nil
+	case status >= 400 && status < 500:
+		return allowAllRobots, nil
+	default:
+		return disallowAllRobots, fmt.Errorf("%w: status code %d", errRobotsUnreachable, status)
+	}
+}
+
+// checkRobots returns errDisallowedByRobots when robots.txt of the request host
+// forbids the request, and applies the Crawl-delay of the host to the limiter.
+func (c *Client) checkRobots(ctx context.Context, req *fasthttp.Request) error {
+	u, err := url.Parse(req.URI().String())
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	rules, err := c.robots.rulesFor(ctx, u)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		c.logger.Warn("Failed to fetch robots.txt", logContext{
+			"host": u.Host,
+			"err":  err,
+		})
+	}
+	if rules == nil {
+		return nil
+	}
+
+	if delay := rules.crawlDelay(c.robots.userAgent); delay > 0 {
+		c.hostLimiter.setHostDelay(u.Host, delay)
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	if !rules.allowed(c.robots.userAgent, path) {
+		return errDisallowedByRobots
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package remilia
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const testRobots = `
+# comment line
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+
+User-agent: remilia
+User-agent: otherbot
+Disallow: /no-remilia
+Crawl-delay: 0.5
+
+Sitemap: http://example.com/sitemap.xml
+`
+
+func TestParseRobots(t *testing.T) {
+	rules := parseRobots([]byte(testRobots))
+
+	assert.Len(t, rules.groups, 2, "parseRobots should build two groups")
+	assert.Equal(t, []string{"*"}, rules.groups[0].agents, "First group should be the wildcard group")
+	assert.Equal(t, []string{"remilia", "otherbot"}, rules.groups[1].agents, "Consecutive user-agent lines should share a group")
+	assert.Len(t, rules.groups[0].rules, 3, "Wildcard group should have 3 rules")
+	assert.Equal(t, 2*time.Second, rules.groups[0].crawlDelay, "Crawl-delay should be parsed")
+	assert.Equal(t, 500*time.Millisecond, rules.groups[1].crawlDelay, "Fractional crawl-delay should be parsed")
+}
+
+func TestRobotsRules(t *testing.T) {
+	rules := parseRobots([]byte(testRobots))
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		allowed   bool
+	}{
+		{"Allowed by default", "somebot", "/index.html", true},
+		{"Disallowed by prefix", "somebot", "/private/data", false},
+		{"Longest rule wins", "somebot", "/private/public/page", true},
+		{"Wildcard with end anchor", "somebot", "/files/report.pdf", false},
+		{"End anchor does not match longer path", "somebot", "/files/report.pdf?download=1", true},
+		{"Specific group replaces wildcard group", "Mozilla/5.0 (compatible; Remilia/1.0)", "/private/data", true},
+		{"Specific group rules apply", "remilia", "/no-remilia/page", false},
+		{"robots.txt is always allowed", "somebot", "/robots.txt", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, rules.allowed(tc.userAgent, tc.path), "allowed should match the rules")
+		})
+	}
+
+	t.Run("Crawl delay of the matching group", func(t *testing.T) {
+		assert.Equal(t, 2*time.Second, rules.crawlDelay("somebot"), "Wildcard crawl-delay should apply")
+		assert.Equal(t, 500*time.Millisecond, rules.crawlDelay("remilia"), "Specific crawl-delay should apply")
+	})
+
+	t.Run("Disallow all", func(t *testing.T) {
+		assert.False(t, disallowAllRobots.allowed("remilia", "/"), "disallowAllRobots should disallow everything")
+		assert.True(t, allowAllRobots.allowed("remilia", "/"), "allowAllRobots should allow everything")
+	})
+}
+
+func TestRobotsCache(t *testing.T) {
+	t.Run("Fetch once per host", func(t *testing.T) {
+		var fetched int32
+		cache := newRobotsCache("remilia", func(_ context.Context, robotsURL string) (*robotsRules, error) {
+			atomic.AddInt32(&fetched, 1)
+			assert.Equal(t, "http://example.com/robots.txt", robotsURL, "fetch should request robots.txt of the host")
+			time.Sleep(time.Millisecond)
+			return allowAllRobots, nil
+		})
+
+		u, _ := url.Parse("http://example.com/page")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rules, err := cache.rulesFor(context.Background(), u)
+				assert.NoError(t, err, "rulesFor should not return error")
+				assert.Same(t, allowAllRobots, rules, "rulesFor should return the fetched rules")
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetched), "robots.txt should be fetched once")
+	})
+
+	t.Run("Cancelled fetch is not cached", func(t *testing.T) {
+		fetched := 0
+		cache := newRobotsCache("remilia", func(ctx context.Context, robotsURL string) (*robotsRules, error) {
+			fetched++
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return disallowAllRobots, nil
+		})
+		u, _ := url.Parse("http://example.com/page")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := cache.rulesFor(ctx, u)
+		assert.ErrorIs(t, err, context.Canceled, "rulesFor should return the context error")
+
+		rules, err := cache.rulesFor(context.Background(), u)
+		assert.NoError(t, err, "rulesFor should not return error")
+		assert.Same(t, disallowAllRobots, rules, "rulesFor should fetch again")
+		assert.Equal(t, 2, fetched, "the cancelled fetch should not be cached")
+	})
+
+	t.Run("Refetch after expiry", func(t *testing.T) {
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0)).Twice()
+		mockClock.On("Now").Return(time.Unix(0, 0).Add(defaultRobotsTTL + time.Second))
+
+		fetched := 0
+		cache := newRobotsCache("remilia", func(_ context.Context, robotsURL string) (*robotsRules, error) {
+			fetched++
+			return allowAllRobots, nil
+		})
+		cache.clock = mockClock
+
+		u, _ := url.Parse("http://example.com/page")
+		cache.rulesFor(context.Background(), u)
+		cache.rulesFor(context.Background(), u)
+		cache.rulesFor(context.Background(), u)
+
+		assert.Equal(t, 2, fetched, "robots.txt should be fetched again once expired")
+	})
+}
+
+// proxyRecordingClient answers every request with a 404, recording the proxies they were sent through.
+type proxyRecordingClient struct {
+	proxies []string
+}
+
+func (c *proxyRecordingClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	resp.SetStatusCode(fasthttp.StatusNotFound)
+	return nil
+}
+
+func (c *proxyRecordingClient) DoProxy(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error {
+	c.proxies = append(c.proxies, proxy.String())
+	return c.Do(req, resp)
+}
+
+func TestClientRobots(t *testing.T) {
+	setup := func(t *testing.T, status int, body string) (*Client, *mockInternalClient, *observer.ObservedLogs) {
+		core, recorded := observer.New(zap.DebugLevel)
+		logger := &defaultLogger{internal: zap.New(core)}
+
+		httpClient := new(mockInternalClient)
+		httpClient.On("Do", mock.MatchedBy(func(req *fasthttp.Request) bool {
+			return strings.HasSuffix(string(req.URI().Path()), "/robots.txt")
+		}), mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.SetStatusCode(status)
+			resp.SetBodyString(body)
+		}).Return(nil)
+
+		client, err := newClient(
+			withInternalClient(httpClient),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			withClientLogger(logger),
+			WithRobotsTxt("remilia"),
+		)
+		assert.NoError(t, err)
+
+		return client, httpClient, recorded
+	}
+
+	t.Run("Drop disallowed request", func(t *testing.T) {
+		client, httpClient, recorded := setup(t, fasthttp.StatusOK, "User-agent: *\nDisallow: /private")
+
+		request, _ := newRequest(withURL("http://example.com/private/page"))
+		response, err := client.execute(context.Background(), request)
+
+		assert.Nil(t, response, "Response should be nil")
+		assert.Equal(t, errDisallowedByRobots, err, "execute should return errDisallowedByRobots")
+		httpClient.AssertNumberOfCalls(t, "Do", 1)
+
+		entries := recorded.FilterMessage("Dropped request").All()
+		assert.Len(t, entries, 1, "Dropped request should be logged")
+		assert.Equal(t, "http://example.com/private/page", entries[0].ContextMap()["url"], "Dropped url should be logged")
+		assert.Equal(t, errDisallowedByRobots.Error(), entries[0].ContextMap()["reason"], "Drop reason should be logged")
+	})
+
+	t.Run("Send allowed request and apply crawl delay", func(t *testing.T) {
+		client, httpClient, _ := setup(t, fasthttp.StatusOK, "User-agent: remilia\nDisallow: /private\nCrawl-delay: 3")
+		httpClient.On("Do", mock.Anything, mock.Anything).Return(nil)
+
+		request, _ := newRequest(withURL("http://example.com/public"))
+		response, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err, "execute should not return error")
+		assert.NotNil(t, response, "Response should not be nil")
+		httpClient.AssertNumberOfCalls(t, "Do", 2)
+
+		hb, _ := client.hostLimiter.bucketFor("example.com")
+		assert.Equal(t, 3*time.Second, hb.delay, "Crawl-delay should be applied to the host limiter")
+	})
+
+	t.Run("Missing robots.txt allows everything", func(t *testing.T) {
+		client, httpClient, _ := setup(t, fasthttp.StatusNotFound, "")
+		httpClient.On("Do", mock.Anything, mock.Anything).Return(nil)
+
+		request, _ := newRequest(withURL("http://example.com/private"))
+		_, err := client.execute(context.Background(), request)
+
+		assert.NoError(t, err, "execute should not return error")
+	})
+
+	t.Run("Unreachable robots.txt disallows everything", func(t *testing.T) {
+		client, _, _ := setup(t, fasthttp.StatusServiceUnavailable, "")
+		mockClock := new(mockClock)
+		mockClock.On("Now").Return(time.Unix(0, 0))
+		client.robots.clock = mockClock
+
+		request, _ := newRequest(withURL("http://example.com/page"))
+		_, err := client.execute(context.Background(), request)
+
+		assert.Equal(t, errDisallowedByRobots, err, "execute should return errDisallowedByRobots")
+		entry := client.robots.entries["http://example.com"]
+		assert.Equal(t, time.Unix(0, 0).Add(defaultRobotsErrorTTL), entry.expires, "An unreachable robots.txt should only be cached briefly")
+	})
+
+	t.Run("Follow redirects of robots.txt", func(t *testing.T) {
+		httpClient := new(mockInternalClient)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			req := args.Get(0).(*fasthttp.Request)
+			resp := args.Get(1).(*fasthttp.Response)
+			if string(req.URI().Host()) == "example.com" {
+				resp.SetStatusCode(fasthttp.StatusMovedPermanently)
+				resp.Header.Set("Location", "https://www.example.com/robots.txt")
+				return
+			}
+			resp.SetStatusCode(fasthttp.StatusOK)
+			resp.SetBodyString("User-agent: *\nAllow: /\n")
+		}).Return(nil)
+
+		client, _ := newClient(
+			withInternalClient(httpClient),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithRobotsTxt("remilia"),
+		)
+
+		rules, err := client.fetchRobots(context.Background(), "http://example.com/robots.txt")
+		assert.NoError(t, err, "fetchRobots should follow the redirect")
+		assert.True(t, rules.allowed("remilia", "/private"), "The redirected robots.txt should allow everything")
+		httpClient.AssertNumberOfCalls(t, "Do", 2)
+	})
+
+	t.Run("Too many redirects allow everything", func(t *testing.T) {
+		httpClient := new(mockInternalClient)
+		httpClient.On("Do", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			resp := args.Get(1).(*fasthttp.Response)
+			resp.SetStatusCode(fasthttp.StatusFound)
+			resp.Header.Set("Location", "/robots.txt")
+		}).Return(nil)
+
+		client, _ := newClient(
+			withInternalClient(httpClient),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithRobotsTxt("remilia"),
+		)
+
+		rules, err := client.fetchRobots(context.Background(), "http://example.com/robots.txt")
+		assert.NoError(t, err, "fetchRobots should not return error")
+		assert.Same(t, allowAllRobots, rules, "fetchRobots should treat robots.txt as unavailable")
+		httpClient.AssertNumberOfCalls(t, "Do", defaultRobotsMaxRedirects+1)
+	})
+
+	t.Run("Fetch is sent through the proxies of the client", func(t *testing.T) {
+		internal := &proxyRecordingClient{}
+		client, _ := newClient(
+			withInternalClient(internal),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithRobotsTxt("remilia"),
+			WithProxy("http://127.0.0.1:3128"),
+		)
+
+		_, err := client.fetchRobots(context.Background(), "http://example.com/robots.txt")
+		assert.NoError(t, err, "fetchRobots should not return error")
+		assert.Equal(t, []string{"http://127.0.0.1:3128"}, internal.proxies, "robots.txt should be fetched through the proxy")
+	})
+
+	t.Run("Cancelled context skips the fetch", func(t *testing.T) {
+		httpClient := new(mockInternalClient)
+		client, _ := newClient(
+			withInternalClient(httpClient),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithRobotsTxt("remilia"),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := client.fetchRobots(ctx, "http://example.com/robots.txt")
+		assert.ErrorIs(t, err, context.Canceled, "fetchRobots should return the context error")
+		httpClient.AssertNotCalled(t, "Do", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Failed fetch disallows everything", func(t *testing.T) {
+		httpClient := new(mockInternalClient)
+		httpClient.On("Do", mock.Anything, mock.Anything).Return(errors.New("network error"))
+
+		client, _ := newClient(
+			withInternalClient(httpClient),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithRobotsTxt("remilia"),
+		)
+
+		rules, err := client.fetchRobots(context.Background(), "http://example.com/robots.txt")
+		assert.Error(t, err, "fetchRobots should return error")
+		assert.Same(t, disallowAllRobots, rules, "fetchRobots should disallow everything")
+	})
+}
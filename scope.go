@@ -0,0 +1,142 @@
+package remilia
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	errDomainNotAllowed = errors.New("domain is not allowed")
+	errDomainBlocked    = errors.New("domain is blocked")
+	errPathNotIncluded  = errors.New("path does not match any include pattern")
+	errPathExcluded     = errors.New("path matches an exclude pattern")
+	errExtensionBlocked = errors.New("file extension is blocked")
+)
+
+// scopePolicy decides which discovered URLs belong to the crawl.
+type scopePolicy struct {
+	allowedDomains    []string
+	blockedDomains    []string
+	includeSubdomains bool
+	includePaths      []*regexp.Regexp
+	excludePaths      []*regexp.Regexp
+	blockedExtensions map[string]struct{}
+}
+
+func newScopePolicy() *scopePolicy {
+	return &scopePolicy{
+		blockedExtensions: make(map[string]struct{}),
+	}
+}
+
+func (p *scopePolicy) matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || p.includeSubdomains && strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the reason u is out of scope, or nil when it is in scope.
+func (p *scopePolicy) check(u *url.URL) error {
+	host := normalizeHost(u.Host)
+
+	if p.matchDomain(host, p.blockedDomains) {
+		return errDomainBlocked
+	}
+
+	if len(p.allowedDomains) > 0 && !p.matchDomain(host, p.allowedDomains) {
+		return errDomainNotAllowed
+	}
+
+	if ext := strings.ToLower(path.Ext(u.Path)); ext != "" {
+		if _, ok := p.blockedExtensions[ext]; ok {
+			return errExtensionBlocked
+		}
+	}
+
+	for _, re := range p.excludePaths {
+		if re.MatchString(u.Path) {
+			return errPathExcluded
+		}
+	}
+
+	if len(p.includePaths) == 0 {
+		return nil
+	}
+	for _, re := range p.includePaths {
+		if re.MatchString(u.Path) {
+			return nil
+		}
+	}
+
+	return errPathNotIncluded
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		normalized = append(normalized, normalizeHost(domain))
+	}
+	return normalized
+}
+
+// WithAllowedDomains restricts the crawl to the given domains.
+func WithAllowedDomains(domains ...string) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.scope.allowedDomains = append(r.scope.allowedDomains, normalizeDomains(domains)...)
+		return nil
+	}
+}
+
+// WithBlockedDomains excludes the given domains from the crawl. Blocked domains
+// take precedence over allowed ones.
+func WithBlockedDomains(domains ...string) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.scope.blockedDomains = append(r.scope.blockedDomains, normalizeDomains(domains)...)
+		return nil
+	}
+}
+
+// WithSubdomains makes allowed and blocked domains also match their subdomains.
+func WithSubdomains(include bool) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.scope.includeSubdomains = include
+		return nil
+	}
+}
+
+// WithIncludePaths only keeps the URLs whose path matches at least one of the patterns.
+func WithIncludePaths(patterns ...*regexp.Regexp) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.scope.includePaths = append(r.scope.includePaths, patterns...)
+		return nil
+	}
+}
+
+// WithExcludePaths drops the URLs whose path matches any of the patterns.
+func WithExcludePaths(patterns ...*regexp.Regexp) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		r.scope.excludePaths = append(r.scope.excludePaths, patterns...)
+		return nil
+	}
+}
+
+// WithBlockedExtensions drops the URLs whose path ends with one of the file
+// extensions, e.g. ".pdf" or "zip".
+func WithBlockedExtensions(extensions ...string) RemiliaOptionFunc {
+	return func(r *Remilia) error {
+		for _, ext := range extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			r.scope.blockedExtensions[ext] = struct{}{}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package remilia
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopePolicy(t *testing.T) {
+	build := func(opts ...RemiliaOptionFunc) *scopePolicy {
+		r := &Remilia{scope: newScopePolicy()}
+		for _, opt := range opts {
+			opt(r)
+		}
+		return r.scope
+	}
+
+	tests := []struct {
+		name     string
+		opts     []RemiliaOptionFunc
+		input    string
+		expected error
+	}{
+		{"Everything is in scope by default", nil, "http://any.com/file.pdf", nil},
+		{"Allowed domain", []RemiliaOptionFunc{WithAllowedDomains("Example.com")}, "http://example.com/page", nil},
+		{"Not allowed domain", []RemiliaOptionFunc{WithAllowedDomains("example.com")}, "http://other.com/page", errDomainNotAllowed},
+		{"Subdomain is not allowed by default", []RemiliaOptionFunc{WithAllowedDomains("example.com")}, "http://www.example.com/page", errDomainNotAllowed},
+		{"Subdomain is allowed with subdomains", []RemiliaOptionFunc{WithAllowedDomains("example.com"), WithSubdomains(true)}, "http://www.example.com/page", nil},
+		{"Allowed domain with port", []RemiliaOptionFunc{WithAllowedDomains("example.com")}, "http://example.com:8080/page", nil},
+		{"Blocked domain", []RemiliaOptionFunc{WithBlockedDomains("ads.com")}, "http://ads.com/page", errDomainBlocked},
+		{"Blocked subdomain with subdomains", []RemiliaOptionFunc{WithBlockedDomains("ads.com"), WithSubdomains(true)}, "http://cdn.ads.com/page", errDomainBlocked},
+		{"Blocked wins over allowed", []RemiliaOptionFunc{WithAllowedDomains("example.com"), WithBlockedDomains("private.example.com"), WithSubdomains(true)}, "http://private.example.com/", errDomainBlocked},
+		{"Blocked extension", []RemiliaOptionFunc{WithBlockedExtensions(".pdf", "ZIP")}, "http://example.com/file.zip", errExtensionBlocked},
+		{"Blocked extension is case insensitive", []RemiliaOptionFunc{WithBlockedExtensions("pdf")}, "http://example.com/file.PDF", errExtensionBlocked},
+		{"Other extension", []RemiliaOptionFunc{WithBlockedExtensions("pdf")}, "http://example.com/file.html", nil},
+		{"Excluded path", []RemiliaOptionFunc{WithExcludePaths(regexp.MustCompile(`^/admin`))}, "http://example.com/admin/users", errPathExcluded},
+		{"Included path", []RemiliaOptionFunc{WithIncludePaths(regexp.MustCompile(`^/articles/`))}, "http://example.com/articles/1", nil},
+		{"Not included path", []RemiliaOptionFunc{WithIncludePaths(regexp.MustCompile(`^/articles/`))}, "http://example.com/about", errPathNotIncluded},
+		{"Excluded wins over included", []RemiliaOptionFunc{WithIncludePaths(regexp.MustCompile(`^/articles/`)), WithExcludePaths(regexp.MustCompile(`/draft$`))}, "http://example.com/articles/draft", errPathExcluded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.input)
+			assert.Equal(t, tt.expected, build(tt.opts...).check(u))
+		})
+	}
+}
+
+func TestCreateWrappedPutScope(t *testing.T) {
+	instance, recorded := setupWrappedFuncTest(t)
+	instance.urlMatcher = urlMatcher()
+	instance.seen = NewMemorySeenStore()
+	instance.normalizer = newURLNormalizer()
+	instance.scope = newScopePolicy()
+	WithAllowedDomains("example.com")(instance)
+
+	requests := make([]*Request, 0)
+	put := instance.createWrappedPut(func(req *Request) {
+		requests = append(requests, req)
+	}, nil, nil)
+
+	put("http://example.com/page")
+	put("http://other.com/page")
+
+	assert.Len(t, requests, 1, "put should only forward the in scope url")
+	assert.Equal(t, uint64(1), instance.Stats().OutOfScope, "Stats should count the out of scope url")
+
+	entries := recorded.FilterMessage("Dropped request").All()
+	assert.Len(t, entries, 1, "Out of scope url should be logged")
+	assert.Equal(t, "http://other.com/page", entries[0].ContextMap()["url"], "Dropped url should be logged")
+	assert.Equal(t, errDomainNotAllowed.Error(), entries[0].ContextMap()["reason"], "Drop reason should be logged")
+}
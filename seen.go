@@ -0,0 +1,36 @@
+package remilia
+
+import "sync"
+
+// SeenStore records the URLs which have already been scheduled, so that links
+// pointing back to visited pages do not make the recycling pipeline loop forever.
+// Implementations must be safe for concurrent use; a bloom filter or an on-disk
+// store can be plugged in with WithSeenStore.
+type SeenStore interface {
+	// Visit marks url as seen and reports whether it had not been seen before.
+	Visit(url string) (bool, error)
+}
+
+type memorySeenStore struct {
+	mu   sync.Mutex
+	urls map[string]struct{}
+}
+
+// NewMemorySeenStore returns a SeenStore which keeps every URL in memory.
+func NewMemorySeenStore() SeenStore {
+	return &memorySeenStore{
+		urls: make(map[string]struct{}),
+	}
+}
+
+func (s *memorySeenStore) Visit(url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[url]; ok {
+		return false, nil
+	}
+	s.urls[url] = struct{}{}
+
+	return true, nil
+}
@@ -0,0 +1,45 @@
+package remilia
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySeenStore(t *testing.T) {
+	t.Run("Visit reports first visit only", func(t *testing.T) {
+		store := NewMemorySeenStore()
+
+		first, err := store.Visit("http://example.com")
+		assert.NoError(t, err, "Visit should not return error")
+		assert.True(t, first, "First visit should report unseen")
+
+		second, err := store.Visit("http://example.com")
+		assert.NoError(t, err, "Visit should not return error")
+		assert.False(t, second, "Second visit should report seen")
+	})
+
+	t.Run("Concurrent visits of the same url", func(t *testing.T) {
+		store := NewMemorySeenStore()
+
+		var mu sync.Mutex
+		unseen := 0
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if ok, _ := store.Visit("http://example.com"); ok {
+					mu.Lock()
+					unseen++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, unseen, "Only one concurrent visit should report unseen")
+	})
+}
@@ -0,0 +1,692 @@
+package remilia
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidMaxFileSize = errors.New("invalid max file size")
+	errInvalidTableName   = errors.New("invalid table name")
+)
+
+var defaultItemBatchSize = uint(100)
+
+// ItemSink persists scraped items. Implementations don't have to be safe for
+// concurrent use, the item pipeline serializes the calls.
+type ItemSink interface {
+	// WriteItems writes a batch of items.
+	WriteItems(items []Item) error
+	// Flush makes every written item durable.
+	Flush() error
+	// Close flushes and releases the sink.
+	Close() error
+}
+
+// SinkError is returned when a sink failed to write a batch of items, which
+// holds the items that were lost.
+type SinkError struct {
+	Items []Item
+	Err   error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("failed to write %d items: %v", len(e.Items), e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// batchingSink buffers items and writes them to the sink in batches.
+type batchingSink struct {
+	mu        sync.Mutex
+	sink      ItemSink
+	batchSize uint
+	batch     []Item
+}
+
+func newBatchingSink(sink ItemSink, batchSize uint) *batchingSink {
+	return &batchingSink{
+		sink:      sink,
+		batchSize: batchSize,
+		batch:     make([]Item, 0, batchSize),
+	}
+}
+
+func (bs *batchingSink) stage() ItemStage {
+	return func(item Item) (Item, error) {
+		bs.mu.Lock()
+		defer bs.mu.Unlock()
+
+		bs.batch = append(bs.batch, item)
+		if uint(len(bs.batch)) < bs.batchSize {
+			return item, nil
+		}
+
+		return item, bs.writeBatch()
+	}
+}
+
+func (bs *batchingSink) writeBatch() error {
+	if len(bs.batch) == 0 {
+		return nil
+	}
+
+	// The batch is reused, so a failed one is handed over as a copy
+	var err error
+	if writeErr := bs.sink.WriteItems(bs.batch); writeErr != nil {
+		err = &SinkError{Items: append([]Item(nil), bs.batch...), Err: writeErr}
+	}
+	bs.batch = bs.batch[:0]
+	return err
+}
+
+// flush writes the partial batch and flushes the sink.
+func (bs *batchingSink) flush() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if err := bs.writeBatch(); err != nil {
+		return err
+	}
+	return bs.sink.Flush()
+}
+
+// itemField is a named value of an item, in the order it is written.
+type itemField struct {
+	name  string
+	value any
+}
+
+// itemFields flattens item into named fields. Maps with string keys give one
+// field per key in sorted order, structs one field per exported field named
+// after its json tag, and any other value a single "value" field.
+func itemFields(item Item) []itemField {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		fields := make([]itemField, 0, len(keys))
+		for _, key := range keys {
+			fields = append(fields, itemField{name: key.String(), value: v.MapIndex(key).Interface()})
+		}
+		return fields
+	case v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}):
+		t := v.Type()
+		fields := make([]itemField, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+
+			name := sf.Name
+			if tag, _, _ := strings.Cut(sf.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			fields = append(fields, itemField{name: name, value: v.Field(i).Interface()})
+		}
+		return fields
+	default:
+		return []itemField{{name: "value", value: item}}
+	}
+}
+
+type fileSinkOptions struct {
+	maxSize  int64
+	truncate bool
+}
+
+type FileSinkOptionFunc optionFunc[*fileSinkOptions]
+
+// WithMaxFileSize starts a new file once the current one would grow beyond size bytes.
+func WithMaxFileSize(size int64) FileSinkOptionFunc {
+	return func(o *fileSinkOptions) error {
+		if size <= 0 {
+			return errInvalidMaxFileSize
+		}
+		o.maxSize = size
+		return nil
+	}
+}
+
+// WithTruncate discards the content of the files left by a previous run
+// instead of appending to them.
+func WithTruncate() FileSinkOptionFunc {
+	return func(o *fileSinkOptions) error {
+		o.truncate = true
+		return nil
+	}
+}
+
+func buildFileSinkOptions(optFns []FileSinkOptionFunc) (*fileSinkOptions, error) {
+	opts := &fileSinkOptions{}
+	for _, optFn := range optFns {
+		if err := optFn(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// rotatingFile writes to path until it reaches maxSize, then continues in
+// numbered files next to it: items.jsonl, items.1.jsonl, items.2.jsonl, ...
+// Unless truncate is set, it appends to the last file left by a previous run.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	truncate bool
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	index  int
+
+	// onOpen is called with every new file, e.g. to write a header.
+	onOpen func() error
+}
+
+func newRotatingFile(path string, opts *fileSinkOptions) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	rf := &rotatingFile{
+		path:     path,
+		maxSize:  opts.maxSize,
+		truncate: opts.truncate,
+	}
+	if !rf.truncate {
+		for {
+			rf.index++
+			if _, err := os.Stat(rf.currentPath()); err != nil {
+				rf.index--
+				break
+			}
+		}
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) currentPath() string {
+	if rf.index == 0 {
+		return rf.path
+	}
+
+	ext := filepath.Ext(rf.path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(rf.path, ext), rf.index, ext)
+}
+
+func (rf *rotatingFile) open() error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if rf.truncate {
+		flag |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(rf.currentPath(), flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.writer = bufio.NewWriter(file)
+	rf.size = info.Size()
+
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.close(); err != nil {
+		return err
+	}
+
+	rf.index++
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if rf.onOpen != nil {
+		return rf.onOpen()
+	}
+	return nil
+}
+
+// Write writes p to the current file, rotating first when p would not fit.
+// A record is never split across two files.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.writer.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Flush() error {
+	if err := rf.writer.Flush(); err != nil {
+		return err
+	}
+	return rf.file.Sync()
+}
+
+func (rf *rotatingFile) close() error {
+	if err := rf.Flush(); err != nil {
+		rf.file.Close()
+		return err
+	}
+	return rf.file.Close()
+}
+
+type jsonLinesSink struct {
+	file *rotatingFile
+}
+
+// NewJSONLinesSink returns a sink writing every item as one JSON object per
+// line to path, appending to the files of a previous run unless WithTruncate is set.
+func NewJSONLinesSink(path string, opts ...FileSinkOptionFunc) (ItemSink, error) {
+	o, err := buildFileSinkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := newRotatingFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonLinesSink{file: file}, nil
+}
+
+func (s *jsonLinesSink) WriteItems(items []Item) error {
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err := s.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonLinesSink) Flush() error {
+	return s.file.Flush()
+}
+
+func (s *jsonLinesSink) Close() error {
+	return s.file.close()
+}
+
+type csvSink struct {
+	file   *rotatingFile
+	header []string
+}
+
+// NewCSVSink returns a sink writing items as CSV rows to path. The header is
+// inferred from the fields of the first item, later items are written in the
+// same column order, missing fields are left empty and extra fields are ignored.
+// Rows are appended to the files of a previous run, following their header,
+// unless WithTruncate is set.
+func NewCSVSink(path string, opts ...FileSinkOptionFunc) (ItemSink, error) {
+	o, err := buildFileSinkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := newRotatingFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &csvSink{file: file}
+	if file.size > 0 {
+		// Rows appended to a file of a previous run follow its header
+		if s.header, err = readCSVHeader(file.currentPath()); err != nil {
+			file.close()
+			return nil, err
+		}
+	}
+	file.onOpen = func() error {
+		return s.writeRecord(s.header)
+	}
+
+	return s, nil
+}
+
+func readCSVHeader(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return csv.NewReader(file).Read()
+}
+
+// writeRecord encodes record into a single write, so that rotation never splits a row.
+func (s *csvSink) writeRecord(record []string) error {
+	var buf strings.Builder
+	w := csv.NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	w.Flush()
+
+	_, err := s.file.Write([]byte(buf.String()))
+	return err
+}
+
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		if b, err := json.Marshal(value); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func (s *csvSink) WriteItems(items []Item) error {
+	for _, item := range items {
+		fields := itemFields(item)
+
+		if s.header == nil {
+			s.header = make([]string, len(fields))
+			for i, field := range fields {
+				s.header[i] = field.name
+			}
+			if err := s.writeRecord(s.header); err != nil {
+				return err
+			}
+		}
+
+		values := make(map[string]any, len(fields))
+		for _, field := range fields {
+			values[field.name] = field.value
+		}
+
+		record := make([]string, len(s.header))
+		for i, name := range s.header {
+			record[i] = formatCSVValue(values[name])
+		}
+		if err := s.writeRecord(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *csvSink) Flush() error {
+	return s.file.Flush()
+}
+
+func (s *csvSink) Close() error {
+	return s.file.close()
+}
+
+type sqliteSink struct {
+	db    *sql.DB
+	table string
+	// columns of the table, nil until loaded from the database. Changes are
+	// only applied once the transaction making them commits.
+	columns map[string]struct{}
+}
+
+// NewSQLiteSink returns a sink inserting items as rows of table in db, which has
+// to be opened with a SQLite driver of your choice. The table is created from
+// the fields of the first batch unless it exists, e.g. from a previous run, and
+// columns for new fields are added as they appear.
+func NewSQLiteSink(db *sql.DB, table string) (ItemSink, error) {
+	if table == "" {
+		return nil, errInvalidTableName
+	}
+
+	return &sqliteSink{
+		db:    db,
+		table: table,
+	}, nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteType returns the column type affinity used for value.
+func sqliteType(value any) string {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return "INTEGER"
+	case float32, float64:
+		return "REAL"
+	case []byte:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue converts value into a type every database/sql driver accepts.
+func sqliteValue(value any) any {
+	switch v := value.(type) {
+	case nil, int64, float64, bool, []byte, string, time.Time:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	if b, err := json.Marshal(value); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// loadColumns returns the columns of the table, which are empty when it doesn't exist yet.
+func (s *sqliteSink) loadColumns(tx *sql.Tx) (map[string]struct{}, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdentifier(s.table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		values := make([]any, len(names))
+		dest := make([]any, len(names))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, name := range names {
+			if name != "name" {
+				continue
+			}
+			switch v := values[i].(type) {
+			case string:
+				columns[v] = struct{}{}
+			case []byte:
+				columns[string(v)] = struct{}{}
+			}
+		}
+	}
+
+	return columns, rows.Err()
+}
+
+// ensureColumns creates the table, or adds the columns it lacks, for fields,
+// recording them in columns.
+func (s *sqliteSink) ensureColumns(tx *sql.Tx, columns map[string]struct{}, fields []itemField) error {
+	if len(columns) == 0 {
+		defs := make([]string, len(fields))
+		for i, field := range fields {
+			defs[i] = quoteIdentifier(field.name) + " " + sqliteType(field.value)
+		}
+
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdentifier(s.table), strings.Join(defs, ", "))
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+		for _, field := range fields {
+			columns[field.name] = struct{}{}
+		}
+		return nil
+	}
+
+	for _, field := range fields {
+		if _, ok := columns[field.name]; ok {
+			continue
+		}
+
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdentifier(s.table), quoteIdentifier(field.name), sqliteType(field.value))
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+		columns[field.name] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s *sqliteSink) WriteItems(items []Item) (err error) {
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The batch works on a copy of the columns, since a rollback undoes its DDL too
+	var columns map[string]struct{}
+	if s.columns == nil {
+		if columns, err = s.loadColumns(tx); err != nil {
+			return err
+		}
+	} else {
+		columns = make(map[string]struct{}, len(s.columns))
+		for name := range s.columns {
+			columns[name] = struct{}{}
+		}
+	}
+
+	for _, item := range items {
+		// An item without fields has nothing to make a row of
+		fields := itemFields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if err = s.ensureColumns(tx, columns, fields); err != nil {
+			return err
+		}
+
+		names := make([]string, len(fields))
+		placeholders := make([]string, len(fields))
+		args := make([]any, len(fields))
+		for i, field := range fields {
+			names[i] = quoteIdentifier(field.name)
+			placeholders[i] = "?"
+			args[i] = sqliteValue(field.value)
+		}
+
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdentifier(s.table), strings.Join(names, ", "), strings.Join(placeholders, ", "))
+		if _, err = tx.Exec(stmt, args...); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.columns = columns
+
+	return nil
+}
+
+// Flush is a no-op, every batch is committed by WriteItems.
+func (s *sqliteSink) Flush() error {
+	return nil
+}
+
+// Close leaves db open, since it is owned by the caller.
+func (s *sqliteSink) Close() error {
+	return nil
+}
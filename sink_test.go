@@ -0,0 +1,503 @@
+package remilia
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	batches [][]Item
+	flushes int
+}
+
+func (s *recordingSink) WriteItems(items []Item) error {
+	s.batches = append(s.batches, append([]Item(nil), items...))
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// recordingDriver is a database/sql driver which records every executed
+// statement. It keeps the schema of the tables, undoing the changes of a
+// transaction when it rolls back, and rejects statements SQLite would reject.
+type recordingDriver struct {
+	mu     sync.Mutex
+	execs  []string
+	args   [][]driver.Value
+	tables map[string][]string
+	// failInsert makes the INSERT with this argument fail.
+	failInsert driver.Value
+
+	snapshot map[string][]string
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: d}, nil
+}
+
+// Connect and Driver make the driver a connector, so that tests don't register it globally.
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *recordingDriver) Driver() driver.Driver {
+	return d
+}
+
+func copyTables(tables map[string][]string) map[string][]string {
+	copied := make(map[string][]string, len(tables))
+	for name, columns := range tables {
+		copied[name] = append([]string(nil), columns...)
+	}
+	return copied
+}
+
+var (
+	createTableRe = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS "(\w+)" \((.*)\)$`)
+	alterTableRe  = regexp.MustCompile(`^ALTER TABLE "(\w+)" ADD COLUMN "(\w+)"`)
+	insertRe      = regexp.MustCompile(`^INSERT INTO "(\w+)" \((.*)\) VALUES`)
+	tableInfoRe   = regexp.MustCompile(`^PRAGMA table_info\("(\w+)"\)$`)
+	columnRe      = regexp.MustCompile(`"(\w+)"`)
+)
+
+func (d *recordingDriver) exec(query string, args []driver.Value) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.tables == nil {
+		d.tables = make(map[string][]string)
+	}
+
+	switch {
+	case createTableRe.MatchString(query):
+		m := createTableRe.FindStringSubmatch(query)
+		if _, ok := d.tables[m[1]]; !ok {
+			for _, column := range columnRe.FindAllStringSubmatch(m[2], -1) {
+				d.tables[m[1]] = append(d.tables[m[1]], column[1])
+			}
+		}
+	case alterTableRe.MatchString(query):
+		m := alterTableRe.FindStringSubmatch(query)
+		for _, column := range d.tables[m[1]] {
+			if column == m[2] {
+				return fmt.Errorf("duplicate column name: %s", m[2])
+			}
+		}
+		d.tables[m[1]] = append(d.tables[m[1]], m[2])
+	case insertRe.MatchString(query):
+		m := insertRe.FindStringSubmatch(query)
+		columns, ok := d.tables[m[1]]
+		if !ok {
+			return fmt.Errorf("no such table: %s", m[1])
+		}
+		for _, column := range columnRe.FindAllStringSubmatch(m[2], -1) {
+			found := false
+			for _, existing := range columns {
+				found = found || existing == column[1]
+			}
+			if !found {
+				return fmt.Errorf("table %s has no column named %s", m[1], column[1])
+			}
+		}
+		for _, arg := range args {
+			if d.failInsert != nil && arg == d.failInsert {
+				return errors.New("constraint failed")
+			}
+		}
+	}
+
+	d.execs = append(d.execs, query)
+	d.args = append(d.args, args)
+	return nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.snapshot = copyTables(c.driver.tables)
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.tables = c.driver.snapshot
+	return nil
+}
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error {
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.conn.driver.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	m := tableInfoRe.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported query: %s", s.query)
+	}
+
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return &tableInfoRows{columns: append([]string(nil), d.tables[m[1]]...)}, nil
+}
+
+// tableInfoRows are the rows of PRAGMA table_info, with the columns SQLite returns.
+type tableInfoRows struct {
+	columns []string
+	next    int
+}
+
+func (r *tableInfoRows) Columns() []string {
+	return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}
+}
+
+func (r *tableInfoRows) Close() error {
+	return nil
+}
+
+func (r *tableInfoRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.columns) {
+		return io.EOF
+	}
+
+	dest[0] = int64(r.next)
+	dest[1] = r.columns[r.next]
+	dest[2] = "TEXT"
+	dest[3] = int64(0)
+	dest[4] = nil
+	dest[5] = int64(0)
+	r.next++
+	return nil
+}
+
+func TestItemFields(t *testing.T) {
+	type product struct {
+		Name    string `json:"name"`
+		Price   float64
+		Hidden  string `json:"-"`
+		private string
+	}
+
+	tests := []struct {
+		name     string
+		item     Item
+		expected []itemField
+	}{
+		{"Map", map[string]any{"b": 2, "a": 1}, []itemField{{"a", 1}, {"b", 2}}},
+		{"Struct", product{Name: "tea", Price: 2.5, Hidden: "x", private: "y"}, []itemField{{"name", "tea"}, {"Price", 2.5}}},
+		{"Struct pointer", &product{Name: "tea"}, []itemField{{"name", "tea"}, {"Price", 0.0}}},
+		{"Scalar", "text", []itemField{{"value", "text"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, itemFields(tt.item))
+		})
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	t.Run("Write", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "items.jsonl")
+		sink, err := NewJSONLinesSink(path)
+		require.NoError(t, err, "NewJSONLinesSink should not return error")
+
+		err = sink.WriteItems([]Item{map[string]string{"a": "1"}, map[string]string{"a": "2"}})
+		assert.NoError(t, err, "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "{\"a\":\"1\"}\n{\"a\":\"2\"}\n", string(content), "Every item should be written as one line")
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		sink, err := NewJSONLinesSink(filepath.Join(dir, "items.jsonl"), WithMaxFileSize(20))
+		require.NoError(t, err, "NewJSONLinesSink should not return error")
+
+		// Each line is 10 bytes, so two of them fit in a file
+		items := []Item{
+			map[string]string{"a": "1"},
+			map[string]string{"a": "2"},
+			map[string]string{"a": "3"},
+		}
+		assert.NoError(t, sink.WriteItems(items), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		first, _ := os.ReadFile(filepath.Join(dir, "items.jsonl"))
+		second, _ := os.ReadFile(filepath.Join(dir, "items.1.jsonl"))
+		assert.Equal(t, "{\"a\":\"1\"}\n{\"a\":\"2\"}\n", string(first), "The first file should hold the first items")
+		assert.Equal(t, "{\"a\":\"3\"}\n", string(second), "The rotated file should hold the rest")
+	})
+
+	t.Run("Append to the files of a previous run", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "items.jsonl")
+		for _, value := range []string{"1", "2", "3"} {
+			sink, err := NewJSONLinesSink(path, WithMaxFileSize(20))
+			require.NoError(t, err, "NewJSONLinesSink should not return error")
+			assert.NoError(t, sink.WriteItems([]Item{map[string]string{"a": value}}), "WriteItems should not return error")
+			assert.NoError(t, sink.Close(), "Close should not return error")
+		}
+
+		first, _ := os.ReadFile(path)
+		second, _ := os.ReadFile(filepath.Join(dir, "items.1.jsonl"))
+		assert.Equal(t, "{\"a\":\"1\"}\n{\"a\":\"2\"}\n", string(first), "Reruns should append to the file")
+		assert.Equal(t, "{\"a\":\"3\"}\n", string(second), "Reruns should keep rotating")
+
+		sink, _ := NewJSONLinesSink(path, WithTruncate())
+		assert.NoError(t, sink.WriteItems([]Item{map[string]string{"a": "4"}}), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		truncated, _ := os.ReadFile(path)
+		assert.Equal(t, "{\"a\":\"4\"}\n", string(truncated), "WithTruncate should discard the previous content")
+	})
+
+	t.Run("Invalid max file size", func(t *testing.T) {
+		_, err := NewJSONLinesSink(filepath.Join(t.TempDir(), "items.jsonl"), WithMaxFileSize(0))
+		assert.Equal(t, errInvalidMaxFileSize, err, "Error should be errInvalidMaxFileSize")
+	})
+}
+
+func TestCSVSink(t *testing.T) {
+	type row struct {
+		Title string `json:"title"`
+		Price int    `json:"price"`
+	}
+
+	t.Run("Header inference", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "items.csv")
+		sink, err := NewCSVSink(path)
+		require.NoError(t, err, "NewCSVSink should not return error")
+
+		items := []Item{
+			row{Title: "tea, green", Price: 3},
+			map[string]any{"price": 4, "extra": true},
+		}
+		assert.NoError(t, sink.WriteItems(items), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "title,price\n\"tea, green\",3\n,4\n", string(content), "Rows should follow the inferred header")
+	})
+
+	t.Run("Append to the file of a previous run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "items.csv")
+		sink, _ := NewCSVSink(path)
+		assert.NoError(t, sink.WriteItems([]Item{row{Title: "a", Price: 1}}), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		sink, err := NewCSVSink(path)
+		require.NoError(t, err, "NewCSVSink should not return error")
+		assert.NoError(t, sink.WriteItems([]Item{map[string]any{"price": 2, "title": "b"}}), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "title,price\na,1\nb,2\n", string(content), "Rows should be appended under the existing header")
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		sink, err := NewCSVSink(filepath.Join(dir, "items.csv"), WithMaxFileSize(10))
+		require.NoError(t, err, "NewCSVSink should not return error")
+
+		items := []Item{row{Title: "a", Price: 1}, row{Title: "b", Price: 2}}
+		assert.NoError(t, sink.WriteItems(items), "WriteItems should not return error")
+		assert.NoError(t, sink.Close(), "Close should not return error")
+
+		first, _ := os.ReadFile(filepath.Join(dir, "items.csv"))
+		second, _ := os.ReadFile(filepath.Join(dir, "items.1.csv"))
+		assert.Equal(t, "title,price\n", string(first), "The first file should hold the header")
+		assert.True(t, strings.HasPrefix(string(second), "title,price\n"), "Every rotated file should start with the header")
+		assert.Contains(t, string(second), "a,1\n", "The rotated file should hold the rows")
+	})
+}
+
+func TestSQLiteSink(t *testing.T) {
+	t.Run("Create and extend the table", func(t *testing.T) {
+		drv := &recordingDriver{}
+		db := sql.OpenDB(drv)
+		defer db.Close()
+
+		_, err := NewSQLiteSink(db, "")
+		assert.Equal(t, errInvalidTableName, err, "Error should be errInvalidTableName")
+
+		sink, err := NewSQLiteSink(db, "items")
+		require.NoError(t, err, "NewSQLiteSink should not return error")
+
+		items := []Item{
+			map[string]any{"title": "tea", "price": 3},
+			map[string]any{"title": "coffee", "price": 4, "tags": []string{"hot"}},
+		}
+		assert.NoError(t, sink.WriteItems(items), "WriteItems should not return error")
+
+		assert.Equal(t, []string{
+			`CREATE TABLE IF NOT EXISTS "items" ("price" INTEGER, "title" TEXT)`,
+			`INSERT INTO "items" ("price", "title") VALUES (?, ?)`,
+			`ALTER TABLE "items" ADD COLUMN "tags" TEXT`,
+			`INSERT INTO "items" ("price", "tags", "title") VALUES (?, ?, ?)`,
+		}, drv.execs, "The table should be created and extended from the item fields")
+		assert.Equal(t, []driver.Value{int64(4), `["hot"]`, "coffee"}, drv.args[3], "Nested values should be stored as JSON")
+	})
+
+	t.Run("Reuse the table of a previous run", func(t *testing.T) {
+		drv := &recordingDriver{tables: map[string][]string{"items": {"price", "title"}}}
+		db := sql.OpenDB(drv)
+		defer db.Close()
+
+		sink, _ := NewSQLiteSink(db, "items")
+		err := sink.WriteItems([]Item{map[string]any{"title": "tea", "price": 3, "tags": "hot"}})
+
+		assert.NoError(t, err, "WriteItems should not return error")
+		assert.Equal(t, []string{
+			`ALTER TABLE "items" ADD COLUMN "tags" TEXT`,
+			`INSERT INTO "items" ("price", "tags", "title") VALUES (?, ?, ?)`,
+		}, drv.execs, "Only the missing columns should be added")
+	})
+
+	t.Run("Recover from a rolled back batch", func(t *testing.T) {
+		drv := &recordingDriver{failInsert: "broken"}
+		db := sql.OpenDB(drv)
+		defer db.Close()
+
+		sink, _ := NewSQLiteSink(db, "items")
+		err := sink.WriteItems([]Item{map[string]any{"title": "broken"}})
+		assert.Error(t, err, "WriteItems should return the insert error")
+		assert.Empty(t, drv.tables, "The table should be rolled back")
+
+		err = sink.WriteItems([]Item{map[string]any{"title": "tea"}})
+		assert.NoError(t, err, "The next batch should create the table again")
+		assert.Equal(t, map[string][]string{"items": {"title"}}, drv.tables, "The table should exist")
+	})
+
+	t.Run("Skip items without fields", func(t *testing.T) {
+		drv := &recordingDriver{}
+		db := sql.OpenDB(drv)
+		defer db.Close()
+
+		sink, _ := NewSQLiteSink(db, "items")
+		err := sink.WriteItems([]Item{map[string]any{}, struct{}{}, map[string]any{"title": "tea"}})
+
+		assert.NoError(t, err, "WriteItems should not return error")
+		assert.Equal(t, []string{
+			`CREATE TABLE IF NOT EXISTS "items" ("title" TEXT)`,
+			`INSERT INTO "items" ("title") VALUES (?)`,
+		}, drv.execs, "Only the item with fields should be written")
+	})
+}
+
+func TestDoWithItemSinks(t *testing.T) {
+	sink := &recordingSink{}
+	instance, _ := New(WithItemSinks(sink), WithItemBatchSize(3))
+	instance.client = &fakeHTTPClient{}
+
+	links := func(in *goquery.Document, put Put[string], emit Put[Item]) {
+		in.Find("a").Each(func(i int, s *goquery.Selection) {
+			href, _ := s.Attr("href")
+			emit(href)
+		})
+	}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddItemLayer(links))
+
+	assert.NoError(t, err, "Do should not return an error")
+	assert.Equal(t, [][]Item{{"/a", "/b"}}, sink.batches, "The partial batch should be written when Do returns")
+	assert.Equal(t, 1, sink.flushes, "The sink should be flushed when Do returns")
+}
+
+// failingSink fails to write every batch.
+type failingSink struct{}
+
+func (failingSink) WriteItems(items []Item) error {
+	return errors.New("disk full")
+}
+
+func (failingSink) Flush() error {
+	return nil
+}
+
+func (failingSink) Close() error {
+	return nil
+}
+
+func TestDoWithFailingItemSink(t *testing.T) {
+	sink := &recordingSink{}
+	instance, _ := New(WithItemSinks(failingSink{}, sink), WithItemBatchSize(2), WithItemWorkers(1))
+	instance.client = &fakeHTTPClient{}
+
+	items := func(in *goquery.Document, put Put[string], emit Put[Item]) {
+		for _, item := range []string{"a", "b", "c"} {
+			emit(item)
+		}
+	}
+
+	err := instance.Do(instance.URLProvider("http://example.com/"), instance.AddItemLayer(items))
+	require.Error(t, err, "Do should return the failed batches")
+
+	var lost []Item
+	var sinkErr *SinkError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		if assert.ErrorAs(t, e, &sinkErr, "every failed batch should be returned") {
+			lost = append(lost, sinkErr.Items...)
+		}
+	}
+	assert.Equal(t, []Item{"a", "b", "c"}, lost, "the lost items should be returned with the error")
+	assert.Equal(t, uint64(3), instance.Stats().ItemsLost, "Stats should count the lost items")
+	assert.Equal(t, [][]Item{{"a", "b"}, {"c"}}, sink.batches, "The other sinks should still get every item")
+}
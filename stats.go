@@ -0,0 +1,50 @@
+package remilia
+
+import "sync/atomic"
+
+// Stats holds counters describing what the crawl has done so far.
+type Stats struct {
+	// Unique is the number of distinct URLs which were scheduled.
+	Unique uint64
+	// Duplicates is the number of URLs dropped because they had been seen before.
+	Duplicates uint64
+	// DepthExceeded is the number of URLs dropped because they were deeper than the maximum depth.
+	DepthExceeded uint64
+	// OutOfScope is the number of URLs dropped by the domain and path scope rules.
+	OutOfScope uint64
+	// ItemsProcessed is the number of items which went through every item stage.
+	ItemsProcessed uint64
+	// ItemsDropped is the number of items dropped by an item stage with ErrDropItem,
+	// including the items rejected by ValidateItem.
+	ItemsDropped uint64
+	// ItemsFailed is the number of items for which an item stage returned an error.
+	ItemsFailed uint64
+	// ItemsLost is the number of processed items which a sink failed to write.
+	ItemsLost uint64
+}
+
+type crawlStats struct {
+	unique        atomic.Uint64
+	duplicates    atomic.Uint64
+	depthExceeded atomic.Uint64
+	outOfScope    atomic.Uint64
+
+	itemsProcessed atomic.Uint64
+	itemsDropped   atomic.Uint64
+	itemsFailed    atomic.Uint64
+	itemsLost      atomic.Uint64
+}
+
+func (s *crawlStats) snapshot() Stats {
+	return Stats{
+		Unique:        s.unique.Load(),
+		Duplicates:    s.duplicates.Load(),
+		DepthExceeded: s.depthExceeded.Load(),
+		OutOfScope:    s.outOfScope.Load(),
+
+		ItemsProcessed: s.itemsProcessed.Load(),
+		ItemsDropped:   s.itemsDropped.Load(),
+		ItemsFailed:    s.itemsFailed.Load(),
+		ItemsLost:      s.itemsLost.Load(),
+	}
+}
@@ -0,0 +1,248 @@
+package remilia
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// defaultDialConcurrency matches the dialer fasthttp uses by default.
+var defaultDialConcurrency = 1000
+
+// Timeouts bounds the phases of a request. A zero field leaves the phase unbounded,
+// or inherits the value of the client when set on a Request.
+type Timeouts struct {
+	// Connect bounds establishing the TCP connection.
+	Connect time.Duration
+	// TLSHandshake bounds the TLS handshake of https connections.
+	TLSHandshake time.Duration
+	// FirstByte bounds waiting for and reading the response.
+	FirstByte time.Duration
+	// Total bounds every attempt from sending the request to reading the whole response.
+	Total time.Duration
+}
+
+func (t Timeouts) valid() bool {
+	return t.Connect >= 0 && t.TLSHandshake >= 0 && t.FirstByte >= 0 && t.Total >= 0
+}
+
+// merge returns t with the non-zero fields of override.
+func (t Timeouts) merge(override Timeouts) Timeouts {
+	if override.Connect > 0 {
+		t.Connect = override.Connect
+	}
+	if override.TLSHandshake > 0 {
+		t.TLSHandshake = override.TLSHandshake
+	}
+	if override.FirstByte > 0 {
+		t.FirstByte = override.FirstByte
+	}
+	if override.Total > 0 {
+		t.Total = override.Total
+	}
+	return t
+}
+
+// timeoutClient is implemented by internal clients which enforce every phase of Timeouts.
+type timeoutClient interface {
+	DoTimeouts(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts) error
+}
+
+// proxyClient is implemented by internal clients which can send a request
+// through a proxy. A nil proxy sends it directly.
+type proxyClient interface {
+	DoProxy(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error
+}
+
+// contextClient is implemented by internal clients which abandon a request in
+// flight once ctx is done. A nil proxy sends it directly.
+type contextClient interface {
+	DoContext(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error
+}
+
+// deadlineClient is implemented by internal clients which only enforce a total deadline.
+type deadlineClient interface {
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// transportConfig tunes how the transport makes and pools connections.
+// Zero fields keep the defaults of the transport.
+type transportConfig struct {
+	// idleConnTimeout is how long an idle keep-alive connection stays open.
+	idleConnTimeout time.Duration
+	maxConnsPerHost int
+	// maxIdleConns bounds the idle connections of transports which pool them
+	// apart from the open ones. fasthttp keeps up to maxConnsPerHost idle
+	// connections per host instead.
+	maxIdleConns int
+	// dnsCacheTTL is how long resolved addresses are cached.
+	dnsCacheTTL time.Duration
+	resolver    Resolver
+	localAddr   *net.TCPAddr
+	tlsConfig   *tls.Config
+}
+
+// tlsConfigOrNew returns the TLS config, creating it on first use.
+func (c *transportConfig) tlsConfigOrNew() *tls.Config {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{}
+	}
+	return c.tlsConfig
+}
+
+// configurableClient is implemented by internal clients which apply the
+// transport options of the client.
+type configurableClient interface {
+	configure(config transportConfig)
+}
+
+// transportKey identifies the settings a fasthttp client is built with.
+type transportKey struct {
+	timeouts Timeouts
+	proxy    string
+}
+
+// fastHTTPTransport sends requests with fasthttp. The connect, TLS and read
+// timeouts of fasthttp are set per client, as is the dialer of a proxy, so a
+// client is built for every distinct combination of them and its connections
+// are reused.
+type fastHTTPTransport struct {
+	mu      sync.Mutex
+	config  transportConfig
+	dialer  *fasthttp.TCPDialer
+	clients map[transportKey]*fasthttp.Client
+}
+
+func newFastHTTPTransport() *fastHTTPTransport {
+	t := &fastHTTPTransport{}
+	t.configure(transportConfig{})
+	return t
+}
+
+// configure replaces the config of the transport, dropping the clients built with the previous one.
+func (t *fastHTTPTransport) configure(config transportConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.config = config
+	t.dialer = &fasthttp.TCPDialer{
+		Concurrency:      defaultDialConcurrency,
+		LocalAddr:        config.localAddr,
+		Resolver:         config.resolver,
+		DNSCacheDuration: config.dnsCacheTTL,
+	}
+	t.clients = make(map[transportKey]*fasthttp.Client)
+}
+
+func (t *fastHTTPTransport) clientFor(timeouts Timeouts, proxy *url.URL) *fasthttp.Client {
+	// The total timeout is enforced per request, so it doesn't need a client of its own
+	timeouts.Total = 0
+	key := transportKey{timeouts: timeouts}
+	if proxy != nil {
+		key.proxy = proxy.String()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[key]
+	if !ok {
+		client = newFastHTTPClient()
+		if timeouts.FirstByte > 0 {
+			client.ReadTimeout = timeouts.FirstByte
+		}
+		if t.config.maxConnsPerHost > 0 {
+			client.MaxConnsPerHost = t.config.maxConnsPerHost
+		}
+		if t.config.idleConnTimeout > 0 {
+			client.MaxIdleConnDuration = t.config.idleConnTimeout
+		}
+		client.TLSConfig = t.config.tlsConfig
+		dialer := t.dialer
+		client.ConfigureClient = func(hc *fasthttp.HostClient) error {
+			hc.Dial = timeoutDialer(hc.IsTLS, hc.TLSConfig, timeouts, proxy, dialer)
+			return nil
+		}
+		t.clients[key] = client
+	}
+	return client
+}
+
+func (t *fastHTTPTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return t.clientFor(Timeouts{}, nil).Do(req, resp)
+}
+
+func (t *fastHTTPTransport) DoTimeouts(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts) error {
+	return t.DoProxy(req, resp, timeouts, nil)
+}
+
+func (t *fastHTTPTransport) DoProxy(req *fasthttp.Request, resp *fasthttp.Response, timeouts Timeouts, proxy *url.URL) error {
+	client := t.clientFor(timeouts, proxy)
+	if timeouts.Total > 0 {
+		return client.DoTimeout(req, resp, timeouts.Total)
+	}
+	return client.Do(req, resp)
+}
+
+// timeoutDialer returns a dial function which connects with dialer, through
+// proxy if it isn't nil, bounding connecting and, for https hosts, the TLS
+// handshake. fasthttp skips its own handshake for the returned TLS connections.
+func timeoutDialer(isTLS bool, tlsConfig *tls.Config, timeouts Timeouts, proxy *url.URL, dialer *fasthttp.TCPDialer) fasthttp.DialFunc {
+	dial := func(addr string) (net.Conn, error) {
+		if timeouts.Connect > 0 {
+			return dialer.DialTimeout(addr, timeouts.Connect)
+		}
+		return dialer.Dial(addr)
+	}
+	if proxy != nil {
+		dial = proxyDialer(proxy, dial, timeouts.Connect)
+	}
+
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil || !isTLS {
+			return conn, err
+		}
+
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				cfg.ServerName = host
+			}
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if timeouts.TLSHandshake > 0 {
+			if err := tlsConn.SetDeadline(time.Now().Add(timeouts.TLSHandshake)); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fasthttp.ErrTLSHandshakeTimeout
+			}
+			return nil, err
+		}
+		if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
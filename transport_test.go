@@ -0,0 +1,186 @@
+package remilia
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+func TestTimeoutsMerge(t *testing.T) {
+	base := Timeouts{Connect: time.Second, FirstByte: 2 * time.Second, Total: 5 * time.Second}
+	merged := base.merge(Timeouts{FirstByte: time.Second, TLSHandshake: 3 * time.Second})
+
+	assert.Equal(t, Timeouts{
+		Connect:      time.Second,
+		TLSHandshake: 3 * time.Second,
+		FirstByte:    time.Second,
+		Total:        5 * time.Second,
+	}, merged, "Non-zero overrides should replace the base timeouts")
+	assert.False(t, Timeouts{Connect: -1}.valid(), "Negative timeouts should be invalid")
+}
+
+func TestFastHTTPTransport(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	doTimeouts := func(url string, timeouts Timeouts) error {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+
+		req.SetRequestURI(url)
+		return newFastHTTPTransport().DoTimeouts(req, resp, timeouts)
+	}
+
+	t.Run("Without timeouts", func(t *testing.T) {
+		assert.NoError(t, doTimeouts(slow.URL, Timeouts{}), "The slow response should be awaited")
+	})
+
+	t.Run("First byte timeout", func(t *testing.T) {
+		err := doTimeouts(slow.URL, Timeouts{FirstByte: 50 * time.Millisecond})
+		assert.Error(t, err, "Waiting for the response should time out")
+	})
+
+	t.Run("Total timeout", func(t *testing.T) {
+		err := doTimeouts(slow.URL, Timeouts{Total: 50 * time.Millisecond})
+		assert.ErrorIs(t, err, fasthttp.ErrTimeout, "The request should time out")
+	})
+
+	t.Run("TLS handshake timeout", func(t *testing.T) {
+		// The listener accepts connections but never answers the handshake
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		err = doTimeouts("https://"+ln.Addr().String(), Timeouts{TLSHandshake: 50 * time.Millisecond})
+		assert.ErrorIs(t, err, fasthttp.ErrTLSHandshakeTimeout, "The handshake should time out")
+	})
+
+	t.Run("Clients are reused per timeouts", func(t *testing.T) {
+		transport := newFastHTTPTransport()
+		first := transport.clientFor(Timeouts{Connect: time.Second, Total: time.Second}, nil)
+		second := transport.clientFor(Timeouts{Connect: time.Second, Total: 2 * time.Second}, nil)
+
+		assert.Same(t, first, second, "Requests differing only in the total timeout should share a client")
+		assert.NotSame(t, first, transport.clientFor(Timeouts{}, nil), "Other timeouts should get their own client")
+	})
+}
+
+// staticResolver resolves every host to 127.0.0.1 and counts the lookups.
+type staticResolver struct {
+	lookups int
+}
+
+func (r *staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups++
+	return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}}, nil
+}
+
+func TestTransportConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer tlsServer.Close()
+
+	send := func(t *testing.T, url string, opts ...ClientOptionFunc) error {
+		client, err := newClient(append([]ClientOptionFunc{
+			withInternalClient(newFastHTTPTransport()),
+			withDocumentCreator(&defaultDocumentCreator{}),
+			withClientLogger(&defaultLogger{internal: zap.NewNop()}),
+			WithMaxAttempt(1),
+		}, opts...)...)
+		assert.NoError(t, err)
+
+		request, _ := NewRequest("GET", url)
+		_, err = client.execute(context.Background(), request)
+		return err
+	}
+
+	t.Run("Client options configure the transport", func(t *testing.T) {
+		internal := newFastHTTPTransport()
+		_, err := newClient(
+			withInternalClient(internal),
+			WithMaxConnsPerHost(16),
+			WithIdleConnTimeout(time.Minute),
+			WithDNSCache(time.Hour),
+			WithLocalAddr("127.0.0.1"),
+			WithInsecureSkipVerify(),
+		)
+		assert.NoError(t, err)
+
+		client := internal.clientFor(Timeouts{}, nil)
+		assert.Equal(t, 16, client.MaxConnsPerHost, "max conns per host should be applied")
+		assert.Equal(t, time.Minute, client.MaxIdleConnDuration, "idle conn timeout should be applied")
+		assert.True(t, client.TLSConfig.InsecureSkipVerify, "the TLS config should be applied")
+		assert.Equal(t, time.Hour, internal.dialer.DNSCacheDuration, "the DNS cache TTL should be applied")
+		assert.Equal(t, "127.0.0.1:0", internal.dialer.LocalAddr.String(), "the local address should be applied")
+	})
+
+	t.Run("Custom resolver", func(t *testing.T) {
+		resolver := &staticResolver{}
+		_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+		err := send(t, "http://remilia.test:"+port+"/", WithResolver(resolver), WithDNSCache(time.Minute))
+
+		assert.NoError(t, err, "the host should be resolved by the custom resolver")
+		assert.Equal(t, 1, resolver.lookups, "the resolver should be asked once")
+	})
+
+	t.Run("Local address binding", func(t *testing.T) {
+		assert.NoError(t, send(t, server.URL, WithLocalAddr("127.0.0.1")), "the connection should be bound to the local address")
+	})
+
+	t.Run("TLS config", func(t *testing.T) {
+		assert.Error(t, send(t, tlsServer.URL), "an unknown authority should be rejected")
+
+		pool := x509.NewCertPool()
+		pool.AddCert(tlsServer.Certificate())
+		assert.NoError(t, send(t, tlsServer.URL, WithRootCAs(pool)), "custom CAs should be trusted")
+		assert.NoError(t, send(t, tlsServer.URL, WithInsecureSkipVerify()), "verification should be skipped")
+	})
+
+	t.Run("Failed to build with invalid options", func(t *testing.T) {
+		testCases := []struct {
+			opt ClientOptionFunc
+			err error
+		}{
+			{WithMaxConnsPerHost(0), errInvalidMaxConns},
+			{WithMaxIdleConns(-1), errInvalidMaxConns},
+			{WithConnectTimeout(-time.Second), errInvalidTimeout},
+			{WithIdleConnTimeout(0), errInvalidTimeout},
+			{WithDNSCache(0), errInvalidTimeout},
+			{WithLocalAddr("not an address"), errInvalidLocalAddr},
+		}
+
+		for _, tc := range testCases {
+			_, err := newClient(tc.opt)
+			assert.ErrorIs(t, err, tc.err, "invalid options should be rejected")
+		}
+	})
+}
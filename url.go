@@ -0,0 +1,141 @@
+package remilia
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var defaultTrackingParams = []string{
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "utm_id",
+	"gclid", "dclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "_ga", "yclid",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// urlNormalizer turns the links found in documents into canonical absolute URLs,
+// so that the same page reached through different spellings is fetched once.
+type urlNormalizer struct {
+	stripParams map[string]struct{}
+}
+
+func newURLNormalizer() *urlNormalizer {
+	return &urlNormalizer{}
+}
+
+func (n *urlNormalizer) addStripParams(params ...string) {
+	if n.stripParams == nil {
+		n.stripParams = make(map[string]struct{})
+	}
+	for _, param := range params {
+		n.stripParams[strings.ToLower(param)] = struct{}{}
+	}
+}
+
+// normalize resolves rawURL against base when it is relative and returns its
+// canonical form: without fragment, with lowercase scheme and host, without
+// default port, with sorted query parameters and without stripped parameters.
+func (n *urlNormalizer) normalize(base *url.URL, rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if port := u.Port(); port != "" && defaultPorts[u.Scheme] == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	if u.Host != "" && u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	if u.RawQuery != "" {
+		u.RawQuery = n.sortQuery(u.RawQuery)
+	}
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// sortQuery sorts the parameters of rawQuery by key and drops the stripped
+// ones. The parameters are kept as they were written, so that valueless
+// flags and parameters separated by ";" keep their meaning.
+func (n *urlNormalizer) sortQuery(rawQuery string) string {
+	type param struct {
+		key string
+		raw string
+	}
+
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		key, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if n != nil {
+			if _, ok := n.stripParams[strings.ToLower(key)]; ok {
+				continue
+			}
+		}
+		params = append(params, param{key: key, raw: raw})
+	}
+
+	// Parameters with the same key keep their order, which may be meaningful
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].key < params[j].key
+	})
+
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// documentBase returns the URL relative links of a document are resolved against:
+// its <base href> when present, otherwise the URL it was fetched from.
+func documentBase(doc *goquery.Document, pageURL string) *url.URL {
+	base, err := url.Parse(pageURL)
+	if err != nil || pageURL == "" {
+		base = nil
+	}
+
+	if doc == nil || doc.Selection == nil {
+		return base
+	}
+
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return base
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return base
+	}
+	if base == nil {
+		return ref
+	}
+
+	return base.ResolveReference(ref)
+}
@@ -0,0 +1,92 @@
+package remilia
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLNormalizer(t *testing.T) {
+	base, _ := url.Parse("http://example.com/articles/list?page=1")
+
+	tests := []struct {
+		name     string
+		base     *url.URL
+		input    string
+		expected string
+	}{
+		{"Absolute URL", nil, "http://example.com/page", "http://example.com/page"},
+		{"Strip fragment", nil, "http://example.com/page#section", "http://example.com/page"},
+		{"Lowercase scheme and host", nil, "HTTP://Example.COM/Page", "http://example.com/Page"},
+		{"Remove default http port", nil, "http://example.com:80/page", "http://example.com/page"},
+		{"Remove default https port", nil, "https://example.com:443/page", "https://example.com/page"},
+		{"Keep custom port", nil, "http://example.com:8080/page", "http://example.com:8080/page"},
+		{"Sort query parameters", nil, "http://example.com/page?b=2&a=1", "http://example.com/page?a=1&b=2"},
+		{"Add root path", nil, "http://example.com", "http://example.com/"},
+		{"Drop empty query", nil, "http://example.com/page?", "http://example.com/page"},
+		{"Keep valueless parameters", nil, "http://example.com/page?flag&a=1", "http://example.com/page?a=1&flag"},
+		{"Keep semicolon separated parameters", nil, "http://example.com/page?b=2;c=3&a=1", "http://example.com/page?a=1&b=2;c=3"},
+		{"Keep order of repeated parameters", nil, "http://example.com/page?id=2&a=1&id=1", "http://example.com/page?a=1&id=2&id=1"},
+		{"Keep escaping of parameters", nil, "http://example.com/page?q=a+b%2Fc", "http://example.com/page?q=a+b%2Fc"},
+		{"Resolve root relative link", base, "/page/2", "http://example.com/page/2"},
+		{"Resolve path relative link", base, "detail/1", "http://example.com/articles/detail/1"},
+		{"Resolve parent relative link", base, "../about", "http://example.com/about"},
+		{"Resolve query only link", base, "?page=2", "http://example.com/articles/list?page=2"},
+		{"Resolve protocol relative link", base, "//other.com/page", "http://other.com/page"},
+		{"Trim surrounding spaces", base, "  /page/3 ", "http://example.com/page/3"},
+		{"Keep tracking parameters by default", nil, "http://example.com/?utm_source=x&id=1", "http://example.com/?id=1&utm_source=x"},
+	}
+
+	normalizer := newURLNormalizer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := normalizer.normalize(tt.base, tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("Strip tracking parameters", func(t *testing.T) {
+		normalizer := newURLNormalizer()
+		normalizer.addStripParams(defaultTrackingParams...)
+		normalizer.addStripParams("sessionid")
+
+		actual, err := normalizer.normalize(nil, "http://example.com/?UTM_Source=x&id=1&gclid=2&sessionid=3")
+		assert.NoError(t, err)
+		assert.Equal(t, "http://example.com/?id=1", actual)
+	})
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		_, err := normalizer.normalize(nil, "http://[::1")
+		assert.Error(t, err)
+	})
+}
+
+func TestDocumentBase(t *testing.T) {
+	newDoc := func(html string) *goquery.Document {
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		return doc
+	}
+
+	t.Run("Use page URL without base element", func(t *testing.T) {
+		base := documentBase(newDoc("<html><body></body></html>"), "http://example.com/a/b")
+		assert.Equal(t, "http://example.com/a/b", base.String())
+	})
+
+	t.Run("Use base element resolved against page URL", func(t *testing.T) {
+		base := documentBase(newDoc(`<html><head><base href="/static/"></head></html>`), "http://example.com/a/b")
+		assert.Equal(t, "http://example.com/static/", base.String())
+	})
+
+	t.Run("Use page URL for empty document", func(t *testing.T) {
+		base := documentBase(&goquery.Document{}, "http://example.com/a/b")
+		assert.Equal(t, "http://example.com/a/b", base.String())
+	})
+
+	t.Run("Return nil without any URL", func(t *testing.T) {
+		assert.Nil(t, documentBase(nil, ""))
+	})
+}